@@ -1,127 +1,508 @@
 package chess
 
 import (
-	"math"
+	"sort"
+	"time"
 )
 
+// SearchResult is the outcome of a search.
+type SearchResult struct {
+	Move  Move
+	Score int // centipawns from the point of view of the side to move
+	Mate  int // moves to mate if positive, to being mated if negative, 0 if no mate was found
+	Depth int
+	Nodes uint64
+	PV    []Move
+	Stats SearchStats
+}
+
+// SearchStats are statistics of a search, e.g. to measure the effect of
+// move ordering.
+type SearchStats struct {
+	Cutoffs          uint64 // beta cutoffs
+	FirstMoveCutoffs uint64 // beta cutoffs by the first move searched
+	TablebaseHits    uint64 // positions scored by the Syzygy or DTM tables
+}
+
+// FirstMoveCutoffRate returns the share of beta cutoffs caused by the first
+// move searched. It approaches 1 with good move ordering.
+func (st SearchStats) FirstMoveCutoffRate() float64 {
+	if st.Cutoffs == 0 {
+		return 0
+	}
+	return float64(st.FirstMoveCutoffs) / float64(st.Cutoffs)
+}
+
+// infinity is larger than any score the search can produce.
+const infinity = 1 << 30
+
+// MateScore is the score of being checkmated, negated. A mate found n plies
+// from the root scores MateScore-n, so faster mates score higher and slower
+// losses lower.
+const MateScore = 1000000
+
+// maxMatePlies bounds the plies to mate of a mate score: the plies of the
+// search and the distance to mate of a DTM table reached at its end.
+const maxMatePlies = 2*MaxSearchDepth + 256
+
+// isMateScore tells whether a score is a mate found by the search.
+func isMateScore(score int) bool {
+	return score >= MateScore-maxMatePlies || score <= -MateScore+maxMatePlies
+}
+
+// mateIn returns the moves to mate of a mate score, negative if the side to
+// move is mated, and 0 for other scores.
+func mateIn(score int) int {
+	switch {
+	case !isMateScore(score):
+		return 0
+	case score > 0:
+		return (MateScore - score + 1) / 2
+	default:
+		return -(MateScore + score) / 2
+	}
+}
+
 func FindBestMove(game *Game, depth int) (Position, Position) {
-	bestScore := math.Inf(-1)
-	var bestMoveFrom Position
-	var bestMoveTo Position
-	board := game.Board()
-	color := game.Turn()
-
-	for r1 := 0; r1 < 8; r1++ {
-		for c1 := 0; c1 < 8; c1++ {
-			piece := board.PieceAt(r1, c1)
-			if piece != nil && piece.Color() == color {
-				from := Position{Row: r1, Col: c1}
-				for r2 := 0; r2 < 8; r2++ {
-					for c2 := 0; c2 < 8; c2++ {
-						to := Position{Row: r2, Col: c2}
-						if IsValidMove(board, game.MoveLog(), from, to) {
-							tempBoard := board.Clone()
-							tempBoard.MovePiece(from, to)
-
-							score := minimax(tempBoard, game.MoveLog(), depth-1, false, color)
-							if score > bestScore {
-								bestScore = score
-								bestMoveFrom = from
-								bestMoveTo = to
-							}
-						}
-					}
-				}
+	result := SearchDepth(game, depth)
+	return result.Move.From(), result.Move.To()
+}
+
+// SearchDepth searches the legal moves of the side to move to the given
+// depth and returns the best one. The result has no move if the side to
+// move has no legal moves.
+//
+// The search is a negamax with alpha-beta pruning and principal variation
+// search: after the first move, each move is searched with a null window
+// that only proves it is not better, and re-searched with the full window
+// if it is.
+func SearchDepth(game *Game, depth int) SearchResult {
+	settings.RLock()
+	defer settings.RUnlock()
+	return newSearcher(game).searchRoot(depth)
+}
+
+// searchRoot runs a single iteration of the search. If the search is
+// stopped, the returned result is incomplete and must be discarded.
+func (s *searcher) searchRoot(depth int) SearchResult {
+	s.pv = make([][]bitMove, depth+1)
+	pos := s.pos
+	bestScore, alpha, beta := -infinity, -infinity, infinity
+	result := SearchResult{Depth: depth}
+
+	// The hash move, the best move of the previous iteration, is searched
+	// first and the others in the usual order. Of equal moves the first in
+	// board order, from a8 to h1 by the from square and then by the to
+	// square, is played, like the original minimax did.
+	moves := pos.legalMoves()
+	if s.tbRoot {
+		moves = append(moves[:0], s.rootMoves...)
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].boardOrder() < moves[j].boardOrder() })
+	var hashMove bitMove
+	if e, ok := s.tt.probe(pos.hash); ok {
+		hashMove = e.move
+	}
+	s.orderMoves(pos, moves, make([]int, 0, len(moves)), hashMove, 0)
+
+	var best []bitMove
+	var top []scoredMove
+	for i, m := range moves {
+		child := *pos
+		child.makeMove(m)
+		s.nodes++
+
+		// A move only has to prove whether it is among the multiPV best.
+		if s.multiPV > 1 {
+			alpha = -infinity
+			if len(top) == s.multiPV {
+				alpha = top[len(top)-1].score
 			}
 		}
+		// A move before the best one in board order also has to prove
+		// whether it is as good.
+		bound := alpha
+		tieBreak := best != nil && m.boardOrder() < best[0].boardOrder()
+		if tieBreak && alpha > -infinity {
+			bound = alpha - 1
+		}
+		var score int
+		if i == 0 || bound == -infinity {
+			score = -s.negamax(&child, depth-1, 1, -beta, -bound)
+		} else {
+			score = -s.negamax(&child, depth-1, 1, -bound-1, -bound)
+			if score > bound && score < beta {
+				score = -s.negamax(&child, depth-1, 1, -beta, -bound)
+			}
+		}
+
+		if i == 0 || score > bestScore || (score == bestScore && tieBreak) {
+			bestScore = score
+			best = append(append(best[:0], m), s.pv[1]...)
+		}
+		if score > alpha {
+			alpha = score
+			if s.multiPV > 1 {
+				top = append(top, scoredMove{m, score})
+				sort.SliceStable(top, func(i, j int) bool { return top[i].score > top[j].score })
+				top = top[:min(len(top), s.multiPV)]
+			}
+		}
+		if s.stopped {
+			break
+		}
+	}
+	s.rootScores = top
+	if !s.stopped && best != nil {
+		s.tt.store(pos.hash, depth, bestScore, boundExact, best[0])
+	}
+	if best != nil {
+		result.PV = s.line(best)
+		result.Move = result.PV[0]
+	} else if pos.inCheck(pos.turn) {
+		bestScore = -MateScore
+	} else {
+		bestScore = 0
+	}
+	if s.tbRoot && !isMateScore(bestScore) {
+		bestScore = s.tbScore
+	}
+	result.Nodes = s.nodes
+	result.Stats = s.stats
+	result.Score = bestScore
+	result.Mate = mateIn(bestScore)
+	return result
+}
+
+// line converts a sequence of moves from the root position into Moves.
+func (s *searcher) line(moves []bitMove) []Move {
+	board := s.game.board.Clone()
+	pos := *s.pos
+	var line []Move
+	for _, m := range moves {
+		move := pos.toMove(board, m, nil)
+		line = append(line, move)
+		applyMove(board, move)
+		pos.makeMove(m)
+	}
+	return line
+}
+
+// scoredMove is a root move with its score.
+type scoredMove struct {
+	move  bitMove
+	score int
+}
+
+// searcher holds the state of a search. It searches the position of the
+// game in bitboard representation.
+type searcher struct {
+	game   *Game
+	pos    *BitPosition
+	tt     *TranspositionTable
+	eval   EvalFunc
+	nodes  uint64
+	pv     [][]bitMove // principal variation found below each ply
+	moves  [][]bitMove // move list buffer of each ply
+	scores [][]int     // move ordering scores of each ply
+	stats  SearchStats
+
+	// Quiet moves that caused cutoffs: two killer moves per ply, and a
+	// history score per color, from and to square.
+	killers [MaxSearchDepth + 1][2]bitMove
+	history [2][64][64]int
+
+	// Number of the best root moves an iteration scores exactly and puts
+	// into rootScores, best first. Otherwise only the score of the best
+	// move is exact.
+	multiPV    int
+	rootScores []scoredMove
+
+	// Root moves that keep the tablebase result and its score, if the
+	// root position is in the tablebases.
+	rootMoves []bitMove
+	tbScore   int
+	tbRoot    bool
+
+	// Limits of an iterative deepening search; zero values mean no limit.
+	deadline time.Time
+	maxNodes uint64
+	done     <-chan struct{} // closed when the search is cancelled
+	canStop  bool
+	stopped  bool
+}
+
+func newSearcher(game *Game) *searcher {
+	s := &searcher{game: game, pos: game.BitPosition(), tt: tt, eval: evaluation}
+	s.rootMoves, s.tbScore, s.tbRoot = endgames.rootMoves(game)
+	if !s.tbRoot {
+		s.rootMoves, s.tbScore, s.tbRoot = syzygy.rootMoves(game)
+	}
+	return s
+}
+
+// checkLimits sets stopped once a limit of the search has been reached or
+// the search has been cancelled. The clock and the cancellation are only
+// checked every 1024 nodes.
+func (s *searcher) checkLimits() {
+	if !s.canStop || s.stopped {
+		return
+	}
+	if s.maxNodes > 0 && s.nodes >= s.maxNodes {
+		s.stopped = true
+	}
+	if s.nodes&1023 != 0 {
+		return
+	}
+	if !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	select {
+	case <-s.done:
+		s.stopped = true
+	default:
 	}
-	return bestMoveFrom, bestMoveTo
 }
 
-func minimax(board *Board, moveLog *MoveLog, depth int, isMaximizingPlayer bool, color Color) float64 {
+// negamax returns the score of the position for the side to move. Scores
+// outside the window (alpha, beta) are only bounds of the exact score.
+//
+// Checkmate scores -MateScore plus the distance to the root, stalemate
+// scores 0.
+func (s *searcher) negamax(pos *BitPosition, depth, ply, alpha, beta int) int {
+	s.pv[ply] = s.pv[ply][:0]
+	s.checkLimits()
+	if s.stopped {
+		return 0
+	}
+
+	// The DTM tables know the exact score.
+	if endgames != nil && pos.occupied.count() <= dtmMaxPieces {
+		if score, ok := endgames.score(pos, ply); ok {
+			s.stats.TablebaseHits++
+			return score
+		}
+	}
 	if depth == 0 {
-		return evaluate(board, color)
-	}
-
-	if isMaximizingPlayer {
-		bestScore := math.Inf(-1)
-		for r1 := 0; r1 < 8; r1++ {
-			for c1 := 0; c1 < 8; c1++ {
-				piece := board.PieceAt(r1, c1)
-				if piece != nil && piece.Color() == color {
-					from := Position{Row: r1, Col: c1}
-					for r2 := 0; r2 < 8; r2++ {
-						for c2 := 0; c2 < 8; c2++ {
-							to := Position{Row: r2, Col: c2}
-							if IsValidMove(board, moveLog, from, to) {
-								tempBoard := board.Clone()
-								tempBoard.MovePiece(from, to)
-								score := minimax(tempBoard, moveLog, depth-1, false, color)
-								bestScore = math.Max(bestScore, score)
-							}
-						}
-					}
-				}
+		return s.quiesce(pos, ply, alpha, beta)
+	}
+
+	var hashMove bitMove
+	if e, ok := s.tt.probe(pos.hash); ok {
+		if int(e.depth) >= depth {
+			score := scoreFromTT(int(e.score), ply)
+			switch {
+			case e.bound == boundExact,
+				e.bound == boundLower && score >= beta,
+				e.bound == boundUpper && score <= alpha:
+				return score
 			}
 		}
-		return bestScore
-	} else {
-		bestScore := math.Inf(1)
-		for r1 := 0; r1 < 8; r1++ {
-			for c1 := 0; c1 < 8; c1++ {
-				piece := board.PieceAt(r1, c1)
-				if piece != nil && piece.Color() != color {
-					from := Position{Row: r1, Col: c1}
-					for r2 := 0; r2 < 8; r2++ {
-						for c2 := 0; c2 < 8; c2++ {
-							to := Position{Row: r2, Col: c2}
-							if IsValidMove(board, moveLog, from, to) {
-								tempBoard := board.Clone()
-								tempBoard.MovePiece(from, to)
-								score := minimax(tempBoard, moveLog, depth-1, true, color)
-								bestScore = math.Min(bestScore, score)
-							}
-						}
-					}
-				}
+		hashMove = e.move
+	}
+
+	// After a capture or pawn move, the tablebases know the result.
+	if syzygy != nil && pos.halfmove == 0 && pos.occupied.count() <= syzygy.maxPieces {
+		if wdl, ok := syzygy.probeWDL(pos); ok {
+			s.stats.TablebaseHits++
+			score, bound := 2*int(wdl), boundExact
+			if wdl == WDLWin {
+				score, bound = tbWinScore, boundLower
+			} else if wdl == WDLLoss {
+				score, bound = -tbWinScore, boundUpper
+			}
+			if bound == boundExact || (bound == boundLower && score >= beta) || (bound == boundUpper && score <= alpha) {
+				// The result holds however deep the position is
+				// searched, so it is stored at the maximum depth and
+				// no search replaces it with a worse estimate.
+				s.tt.store(pos.hash, MaxSearchDepth, score, bound, 0)
+				return score
 			}
 		}
-		return bestScore
 	}
-}
 
-func evaluate(board *Board, color Color) float64 {
-	var score float64
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			piece := board.PieceAt(r, c)
-			if piece != nil {
-				value := getPieceValue(piece.Type())
-				if piece.Color() == color {
-					score += value
-				} else {
-					score -= value
-				}
+	moves, scores := s.buffers(ply)
+	moves = pos.generateMoves(moves)
+	s.orderMoves(pos, moves, scores, hashMove, ply)
+
+	alphaOrig := alpha
+	bestScore := -infinity
+	var bestMove bitMove
+	legal := 0
+	for _, m := range moves {
+		child := *pos
+		child.makeMove(m)
+		if child.inCheck(pos.turn) {
+			continue
+		}
+		legal++
+		s.nodes++
+
+		var score int
+		if legal == 1 {
+			score = -s.negamax(&child, depth-1, ply+1, -beta, -alpha)
+		} else {
+			score = -s.negamax(&child, depth-1, ply+1, -alpha-1, -alpha)
+			if score > alpha && score < beta {
+				score = -s.negamax(&child, depth-1, ply+1, -beta, -alpha)
 			}
 		}
+
+		if score > bestScore {
+			bestScore = score
+			bestMove = m
+		}
+		if score > alpha {
+			alpha = score
+			s.pv[ply] = append(append(s.pv[ply][:0], m), s.pv[ply+1]...)
+		}
+		if alpha >= beta {
+			s.stats.Cutoffs++
+			if legal == 1 {
+				s.stats.FirstMoveCutoffs++
+			}
+			if !pos.isTactical(m) {
+				s.rememberQuiet(pos, m, depth, ply)
+			}
+			break
+		}
+	}
+
+	if legal == 0 {
+		if pos.inCheck(pos.turn) {
+			return -MateScore + ply
+		}
+		return 0
+	}
+
+	if !s.stopped {
+		bound := boundExact
+		if bestScore <= alphaOrig {
+			bound = boundUpper
+		} else if bestScore >= beta {
+			bound = boundLower
+		}
+		s.tt.store(pos.hash, depth, scoreToTT(bestScore, ply), bound, bestMove)
+	}
+	return bestScore
+}
+
+// deltaMargin is added to the value of a capture in delta pruning, as
+// the position may improve beyond the material won.
+const deltaMargin = 200
+
+// quiesce searches captures and queen promotions only, so that positions
+// are evaluated when they are quiet rather than in the middle of an
+// exchange. The side to move may stand pat, i.e. decline to capture,
+// unless it is in check: then all evasions are searched, and without any
+// it is checkmated.
+func (s *searcher) quiesce(pos *BitPosition, ply, alpha, beta int) int {
+	s.checkLimits()
+	if s.stopped {
+		return 0
+	}
+	inCheck := pos.inCheck(pos.turn)
+	standPat := -infinity
+	if !inCheck {
+		standPat = s.eval(pos)
+		if standPat >= beta {
+			return standPat
+		}
+		if standPat > alpha {
+			alpha = standPat
+		}
+	}
+
+	moves, scores := s.buffers(ply)
+	if inCheck {
+		moves = pos.generateMoves(moves)
+	} else {
+		moves = pos.generateCaptures(moves)
+	}
+	for _, m := range moves {
+		scores = append(scores, pos.mvvLva(m))
+	}
+	sortMoves(moves, scores)
+
+	best := standPat
+	legal := 0
+	for _, m := range moves {
+		// Delta pruning: skip captures that cannot raise alpha even
+		// with a margin.
+		if !inCheck && standPat+pos.captureValue(m)+deltaMargin <= alpha {
+			continue
+		}
+		child := *pos
+		child.makeMove(m)
+		if child.inCheck(pos.turn) {
+			continue
+		}
+		legal++
+		s.nodes++
+		score := -s.quiesce(&child, ply+1, -beta, -alpha)
+		if score > best {
+			best = score
+		}
+		if score >= beta {
+			break
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	if inCheck && legal == 0 {
+		return -MateScore + ply
+	}
+	return best
+}
+
+// buffers returns the empty move and score buffers of a ply.
+func (s *searcher) buffers(ply int) ([]bitMove, []int) {
+	for len(s.moves) <= ply {
+		s.moves = append(s.moves, make([]bitMove, 0, 256))
+		s.scores = append(s.scores, make([]int, 0, 256))
+	}
+	return s.moves[ply][:0], s.scores[ply][:0]
+}
+
+// scoreToTT converts a mate score from distance to the root into distance
+// to the position, as stored in the transposition table.
+func scoreToTT(score, ply int) int {
+	switch {
+	case score >= MateScore-maxMatePlies:
+		return score + ply
+	case score <= -MateScore+maxMatePlies:
+		return score - ply
 	}
 	return score
 }
 
-func getPieceValue(pieceType PieceType) float64 {
+// scoreFromTT is the inverse of scoreToTT.
+func scoreFromTT(score, ply int) int {
+	switch {
+	case score >= MateScore-maxMatePlies:
+		return score - ply
+	case score <= -MateScore+maxMatePlies:
+		return score + ply
+	}
+	return score
+}
+
+// getPieceValue returns the material value of a piece in centipawns.
+func getPieceValue(pieceType PieceType) int {
 	switch pieceType {
 	case Pawn:
-		return 1
+		return 100
 	case Knight:
-		return 3
+		return 300
 	case Bishop:
-		return 3
+		return 300
 	case Rook:
-		return 5
+		return 500
 	case Queen:
-		return 9
-	case King:
 		return 900
+	case King:
+		return 90000
 	default:
 		return 0
 	}
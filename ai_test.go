@@ -0,0 +1,130 @@
+package chess
+
+import (
+	"sort"
+	"testing"
+)
+
+// minimax searches every move with a full window, without pruning and
+// without the transposition table, so its scores are exact.
+func (s *searcher) minimax(pos *BitPosition, depth, ply int) int {
+	if depth == 0 {
+		return s.quiesce(pos, ply, -infinity, infinity)
+	}
+	moves := pos.legalMoves()
+	if len(moves) == 0 {
+		if pos.inCheck(pos.turn) {
+			return -MateScore + ply
+		}
+		return 0
+	}
+	best := -infinity
+	for _, m := range moves {
+		child := *pos
+		child.makeMove(m)
+		s.nodes++
+		best = max(best, -s.minimax(&child, depth-1, ply+1))
+	}
+	return best
+}
+
+// minimaxRoot plays the first move of the best score in board order.
+func minimaxRoot(game *Game, depth int) (Move, int, uint64) {
+	s := newSearcher(game)
+	var best bitMove
+	bestScore := -infinity
+	moves := s.pos.legalMoves()
+	sort.Slice(moves, func(i, j int) bool { return moves[i].boardOrder() < moves[j].boardOrder() })
+	for _, m := range moves {
+		child := *s.pos
+		child.makeMove(m)
+		s.nodes++
+		if score := -s.minimax(&child, depth-1, 1); score > bestScore || best == 0 {
+			best, bestScore = m, score
+		}
+	}
+	return s.line([]bitMove{best})[0], bestScore, s.nodes
+}
+
+func TestAlphaBetaMatchesMinimax(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3",
+		"r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/3P1N2/PPP2PPP/RNBQK2R w KQkq - 1 5",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1",
+	}
+	for _, fen := range fens {
+		for depth := 1; depth <= 3; depth++ {
+			game, err := ParseFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, wantScore, minimaxNodes := minimaxRoot(game, depth)
+			ClearHash()
+			got := SearchDepth(game, depth)
+			if got.Move.UCI() != want.UCI() || got.Score != wantScore {
+				t.Errorf("%s depth %d: got %s (%d), minimax %s (%d)", fen, depth, got.Move.UCI(), got.Score, want.UCI(), wantScore)
+			}
+			if depth > 1 && got.Nodes >= minimaxNodes {
+				t.Errorf("%s depth %d: %d nodes, minimax %d", fen, depth, got.Nodes, minimaxNodes)
+			}
+		}
+	}
+}
+
+// BenchmarkFindBestMove searches the middle game position of the perft
+// suite ("kiwipete") to depth 4 and reports the nodes searched per second.
+func BenchmarkFindBestMove(b *testing.B) {
+	game, err := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var nodes uint64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ClearHash()
+		b.StartTimer()
+		nodes += SearchDepth(game, 4).Nodes
+	}
+	b.ReportMetric(float64(nodes)/b.Elapsed().Seconds(), "nodes/s")
+}
+
+func TestQuiescenceSeesMate(t *testing.T) {
+	// Qxf7# is a capture, so even a search of depth 1 must see the mate.
+	game, err := ParseFEN("r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := SearchDepth(game, 1)
+	if r.Move.UCI() != "h5f7" || r.Mate != 1 {
+		t.Errorf("got %s with mate %d, want h5f7 mate 1", r.Move.UCI(), r.Mate)
+	}
+}
+
+func TestParallelSearch(t *testing.T) {
+	// Run with -race: the threads share the transposition table.
+	SetThreads(4)
+	defer SetThreads(1)
+	ClearHash()
+	game, err := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Search(game, SearchLimits{Depth: 5}, nil)
+	if _, ok := game.LegalMove(r.Move.from, r.Move.to, nil); !ok || r.PV == nil {
+		t.Errorf("got illegal move %s", r.Move.UCI())
+	}
+}
+
+func TestSearchKeepsHashMove(t *testing.T) {
+	// A search after a deeper one, stopped in the middle of an iteration,
+	// finds bounds of the deeper search in the transposition table. It has
+	// to search the hash move first to come to the same move.
+	ClearHash()
+	game := NewGame()
+	deep := Search(game, SearchLimits{Nodes: 1000000}, nil)
+	if r := Search(game, SearchLimits{Depth: 3}, nil); r.Move.UCI() != deep.Move.UCI() {
+		t.Errorf("got %s after a search of depth %d that played %s", r.Move.UCI(), deep.Depth, deep.Move.UCI())
+	}
+}
@@ -0,0 +1,109 @@
+package chess
+
+import "math/bits"
+
+// Bitboard is a set of squares with one bit per square. Squares are
+// numbered row*8+col like everywhere else, so bit 0 is a8 and bit 63 is h1.
+type Bitboard uint64
+
+func squareBB(sq int) Bitboard {
+	return 1 << uint(sq)
+}
+
+func (b Bitboard) count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+// lsb returns the lowest square of a non-empty set.
+func (b Bitboard) lsb() int {
+	return bits.TrailingZeros64(uint64(b))
+}
+
+// msb returns the highest square of a non-empty set.
+func (b Bitboard) msb() int {
+	return 63 - bits.LeadingZeros64(uint64(b))
+}
+
+// pop removes the lowest square from a non-empty set and returns it.
+func (b *Bitboard) pop() int {
+	sq := b.lsb()
+	*b &= *b - 1
+	return sq
+}
+
+// Ray directions. The first four lead to higher squares, so the nearest
+// blocker on a ray is its lowest square; the last four lead to lower ones.
+const (
+	dirSouth = iota
+	dirEast
+	dirSouthEast
+	dirSouthWest
+	dirNorth
+	dirWest
+	dirNorthWest
+	dirNorthEast
+)
+
+var rayDirs = [8][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}, {-1, 0}, {0, -1}, {-1, -1}, {-1, 1}}
+
+// Precomputed attacks of each piece type from each square on an empty
+// board. Sliding attacks are cut off at the first blocker of each ray.
+var (
+	knightAttacks [64]Bitboard
+	kingAttacks   [64]Bitboard
+	pawnAttacks   [2][64]Bitboard
+	rays          [8][64]Bitboard
+)
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		from := Position{Row: sq / 8, Col: sq % 8}
+		for _, o := range knightOffsets {
+			if to := (Position{Row: from.Row + o[0], Col: from.Col + o[1]}); onBoard(to) {
+				knightAttacks[sq] |= squareBB(to.Row*8 + to.Col)
+			}
+		}
+		for _, o := range kingOffsets {
+			if to := (Position{Row: from.Row + o[0], Col: from.Col + o[1]}); onBoard(to) {
+				kingAttacks[sq] |= squareBB(to.Row*8 + to.Col)
+			}
+		}
+		for _, dc := range []int{-1, 1} {
+			if to := (Position{Row: from.Row - 1, Col: from.Col + dc}); onBoard(to) {
+				pawnAttacks[White][sq] |= squareBB(to.Row*8 + to.Col)
+			}
+			if to := (Position{Row: from.Row + 1, Col: from.Col + dc}); onBoard(to) {
+				pawnAttacks[Black][sq] |= squareBB(to.Row*8 + to.Col)
+			}
+		}
+		for dir, d := range rayDirs {
+			to := Position{Row: from.Row + d[0], Col: from.Col + d[1]}
+			for onBoard(to) {
+				rays[dir][sq] |= squareBB(to.Row*8 + to.Col)
+				to = Position{Row: to.Row + d[0], Col: to.Col + d[1]}
+			}
+		}
+	}
+}
+
+func rayAttacks(dir, sq int, occupied Bitboard) Bitboard {
+	attacks := rays[dir][sq]
+	if blockers := attacks & occupied; blockers != 0 {
+		if dir < dirNorth {
+			attacks ^= rays[dir][blockers.lsb()]
+		} else {
+			attacks ^= rays[dir][blockers.msb()]
+		}
+	}
+	return attacks
+}
+
+func rookAttacks(sq int, occupied Bitboard) Bitboard {
+	return rayAttacks(dirSouth, sq, occupied) | rayAttacks(dirEast, sq, occupied) |
+		rayAttacks(dirNorth, sq, occupied) | rayAttacks(dirWest, sq, occupied)
+}
+
+func bishopAttacks(sq int, occupied Bitboard) Bitboard {
+	return rayAttacks(dirSouthEast, sq, occupied) | rayAttacks(dirSouthWest, sq, occupied) |
+		rayAttacks(dirNorthWest, sq, occupied) | rayAttacks(dirNorthEast, sq, occupied)
+}
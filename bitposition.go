@@ -0,0 +1,439 @@
+package chess
+
+// noPiece marks an empty square of BitPosition.squares.
+const noPiece = -1
+
+// BitPosition is a position in bitboard representation: one set of squares
+// per piece type and color. The move generator and the search work on it;
+// Board remains the representation of the front ends.
+type BitPosition struct {
+	pieces   [2][6]Bitboard
+	colors   [2]Bitboard
+	occupied Bitboard
+	squares  [64]int8 // color*6 + piece type on each square, or noPiece
+	turn     Color
+	castling int  // castling mask, see castlingMask
+	ep       int8 // en passant target square, or noSquare
+	halfmove int
+
+	// Zobrist hash, equal to Game.Hash of the same position. epHash is
+	// the en passant part of it.
+	hash   uint64
+	epHash uint64
+}
+
+// castleKeep holds the castling rights that remain when a piece moves from
+// or to a square.
+var castleKeep [64]int
+
+func init() {
+	all := castleWhiteKingside | castleWhiteQueenside | castleBlackKingside | castleBlackQueenside
+	for sq := range castleKeep {
+		castleKeep[sq] = all
+	}
+	castleKeep[60] &^= castleWhiteKingside | castleWhiteQueenside
+	castleKeep[63] &^= castleWhiteKingside
+	castleKeep[56] &^= castleWhiteQueenside
+	castleKeep[4] &^= castleBlackKingside | castleBlackQueenside
+	castleKeep[7] &^= castleBlackKingside
+	castleKeep[0] &^= castleBlackQueenside
+}
+
+// NewBitPosition converts a board with the side to move and en passant
+// target square into a BitPosition.
+func NewBitPosition(board *Board, turn Color, ep *Position) *BitPosition {
+	p := &BitPosition{turn: turn, castling: castlingMask(board), ep: noSquare}
+	for sq := range p.squares {
+		p.squares[sq] = noPiece
+	}
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			if piece := board[r][c]; piece != nil {
+				p.put(r*8+c, piece.color, piece.pieceType)
+			}
+		}
+	}
+	if turn == Black {
+		p.hash ^= zobrist.black
+	}
+	p.hash ^= castlingKey(p.castling)
+	if ep != nil {
+		p.ep = int8(ep.Row*8 + ep.Col)
+		p.epHash = p.enPassantKey()
+		p.hash ^= p.epHash
+	}
+	return p
+}
+
+// BitPosition returns the current position of the game as a BitPosition.
+func (g *Game) BitPosition() *BitPosition {
+	p := NewBitPosition(g.board, g.turn, g.enPassant)
+	p.halfmove = g.halfmoveClock
+	return p
+}
+
+// Board converts the position back into a Board. Kings and rooks have
+// moved unless they can castle, pawns unless they are on their initial
+// rank.
+func (p *BitPosition) Board() *Board {
+	board := &Board{}
+	for sq, pc := range p.squares {
+		if pc == noPiece {
+			continue
+		}
+		color, pt := Color(pc/6), PieceType(pc%6)
+		piece := NewPiece(pt, color)
+		switch pt {
+		case Pawn:
+			piece.hasMoved = (color == White && sq/8 != 6) || (color == Black && sq/8 != 1)
+		case King, Rook:
+			piece.hasMoved = true
+		}
+		board[sq/8][sq%8] = piece
+	}
+	unmove := func(right, row, rookCol int) {
+		if p.castling&right != 0 {
+			board[row][4].hasMoved = false
+			board[row][rookCol].hasMoved = false
+		}
+	}
+	unmove(castleWhiteKingside, 7, 7)
+	unmove(castleWhiteQueenside, 7, 0)
+	unmove(castleBlackKingside, 0, 7)
+	unmove(castleBlackQueenside, 0, 0)
+	return board
+}
+
+// Turn returns the side to move.
+func (p *BitPosition) Turn() Color {
+	return p.turn
+}
+
+// EnPassantTarget returns the en passant target square, or nil.
+func (p *BitPosition) EnPassantTarget() *Position {
+	if p.ep == noSquare {
+		return nil
+	}
+	return &Position{Row: int(p.ep) / 8, Col: int(p.ep) % 8}
+}
+
+// Hash returns the Zobrist hash of the position.
+func (p *BitPosition) Hash() uint64 {
+	return p.hash
+}
+
+func (p *BitPosition) put(sq int, color Color, pt PieceType) {
+	bb := squareBB(sq)
+	p.pieces[color][pt] |= bb
+	p.colors[color] |= bb
+	p.occupied |= bb
+	p.squares[sq] = int8(int(color)*6 + int(pt))
+	p.hash ^= zobrist.pieces[color][pt][sq]
+}
+
+func (p *BitPosition) remove(sq int, color Color, pt PieceType) {
+	bb := squareBB(sq)
+	p.pieces[color][pt] &^= bb
+	p.colors[color] &^= bb
+	p.occupied &^= bb
+	p.squares[sq] = noPiece
+	p.hash ^= zobrist.pieces[color][pt][sq]
+}
+
+// pieceAt returns the color and type of the piece on a square, ok is false
+// if it is empty.
+func (p *BitPosition) pieceAt(sq int) (color Color, pt PieceType, ok bool) {
+	pc := p.squares[sq]
+	if pc == noPiece {
+		return 0, 0, false
+	}
+	return Color(pc / 6), PieceType(pc % 6), true
+}
+
+// attacked tells whether a square is attacked by the given color, with
+// only the pieces on the occupied squares taking part.
+func (p *BitPosition) attacked(sq int, by Color, occupied Bitboard) bool {
+	pcs := &p.pieces[by]
+	if pawnAttacks[opposite(by)][sq]&pcs[Pawn]&occupied != 0 ||
+		knightAttacks[sq]&pcs[Knight]&occupied != 0 ||
+		kingAttacks[sq]&pcs[King] != 0 {
+		return true
+	}
+	if bishopAttacks(sq, occupied)&(pcs[Bishop]|pcs[Queen])&occupied != 0 {
+		return true
+	}
+	return rookAttacks(sq, occupied)&(pcs[Rook]|pcs[Queen])&occupied != 0
+}
+
+// inCheck tells whether the king of the given color is attacked.
+func (p *BitPosition) inCheck(color Color) bool {
+	king := p.pieces[color][King]
+	return king != 0 && p.attacked(king.lsb(), opposite(color), p.occupied)
+}
+
+// enPassantKey returns the hash key of the en passant square. Like
+// epKey, it is only hashed if the side to move can legally capture.
+func (p *BitPosition) enPassantKey() uint64 {
+	ep := int(p.ep)
+	victim := ep + 8
+	if p.turn == Black {
+		victim = ep - 8
+	}
+	king := p.pieces[p.turn][King]
+	for pawns := pawnAttacks[opposite(p.turn)][ep] & p.pieces[p.turn][Pawn]; pawns != 0; {
+		from := pawns.pop()
+		occupied := p.occupied ^ squareBB(from) ^ squareBB(victim) | squareBB(ep)
+		if king == 0 || !p.attacked(king.lsb(), opposite(p.turn), occupied) {
+			return zobrist.epFile[ep%8]
+		}
+	}
+	return 0
+}
+
+// bitMove is a move of a BitPosition: the from square in bits 0-5, the to
+// square in bits 6-11 and the promotion piece type + 1 in bits 12-14. The
+// zero value is no move.
+type bitMove uint16
+
+func newBitMove(from, to int) bitMove {
+	return bitMove(from | to<<6)
+}
+
+func (m bitMove) from() int {
+	return int(m & 63)
+}
+
+func (m bitMove) to() int {
+	return int(m >> 6 & 63)
+}
+
+func (m bitMove) promotion() (PieceType, bool) {
+	pt := int(m >> 12)
+	return PieceType(pt - 1), pt != 0
+}
+
+func (m bitMove) withPromotion(pt PieceType) bitMove {
+	return m | bitMove(pt+1)<<12
+}
+
+// boardOrder orders moves by the from square, the to square and the
+// promotion piece, queen first.
+func (m bitMove) boardOrder() int {
+	return m.from()<<9 | m.to()<<3 | int(m>>12)
+}
+
+// toBitMove converts a move into a bitMove.
+func toBitMove(m Move) bitMove {
+	bm := newBitMove(m.from.Row*8+m.from.Col, m.to.Row*8+m.to.Col)
+	if m.isPromotion {
+		bm = bm.withPromotion(m.promotion)
+	}
+	return bm
+}
+
+// toMove converts a legal bitMove of the position into a Move, taking the
+// moved piece from the board. legal are the legal moves of the position,
+// or nil, see san.
+func (p *BitPosition) toMove(board *Board, m bitMove, legal []bitMove) Move {
+	move := Move{
+		from:  Position{Row: m.from() / 8, Col: m.from() % 8},
+		to:    Position{Row: m.to() / 8, Col: m.to() % 8},
+		piece: *board[m.from()/8][m.from()%8],
+	}
+	move.isCapture = p.squares[m.to()] != noPiece || (move.piece.pieceType == Pawn && move.from.Col != move.to.Col)
+	if pt, ok := m.promotion(); ok {
+		move.promotion, move.isPromotion = pt, true
+	}
+	move.notation = p.san(m, legal)
+	return move
+}
+
+// makeMove plays a pseudo-legal move. Positions are small, so the search
+// copies a position before a move instead of taking the move back.
+func (p *BitPosition) makeMove(m bitMove) {
+	from, to := m.from(), m.to()
+	color, pt, _ := p.pieceAt(from)
+	them := opposite(color)
+
+	p.hash ^= p.epHash ^ castlingKey(p.castling) ^ zobrist.black
+	p.halfmove++
+	if capColor, capType, ok := p.pieceAt(to); ok {
+		p.remove(to, capColor, capType)
+		p.halfmove = 0
+	} else if pt == Pawn && to == int(p.ep) {
+		victim := to + 8
+		if color == Black {
+			victim = to - 8
+		}
+		p.remove(victim, them, Pawn)
+	}
+
+	p.remove(from, color, pt)
+	if promotion, ok := m.promotion(); ok {
+		p.put(to, color, promotion)
+	} else {
+		p.put(to, color, pt)
+	}
+
+	p.ep = noSquare
+	switch pt {
+	case Pawn:
+		p.halfmove = 0
+		if to-from == 16 || from-to == 16 {
+			p.ep = int8((from + to) / 2)
+		}
+	case King:
+		if to-from == 2 {
+			p.remove(from+3, color, Rook)
+			p.put(from+1, color, Rook)
+		} else if from-to == 2 {
+			p.remove(from-4, color, Rook)
+			p.put(from-1, color, Rook)
+		}
+	}
+
+	p.castling &= castleKeep[from] & castleKeep[to]
+	p.turn = them
+	p.epHash = 0
+	if p.ep != noSquare {
+		p.epHash = p.enPassantKey()
+	}
+	p.hash ^= p.epHash ^ castlingKey(p.castling)
+}
+
+// generateMoves appends the pseudo-legal moves of the side to move to
+// moves: all moves of the pieces that do not need to leave the own king
+// safe, except that castling is only generated if the king does not
+// castle out of, through or into check.
+func (p *BitPosition) generateMoves(moves []bitMove) []bitMove {
+	return p.generate(moves, false)
+}
+
+// generateCaptures appends the pseudo-legal captures and queen promotions
+// of the side to move to moves, as searched by the quiescence search.
+func (p *BitPosition) generateCaptures(moves []bitMove) []bitMove {
+	return p.generate(moves, true)
+}
+
+func (p *BitPosition) generate(moves []bitMove, capturesOnly bool) []bitMove {
+	us, them := p.turn, opposite(p.turn)
+	own, enemy := p.colors[us], p.colors[them]
+	pcs := &p.pieces[us]
+	targets := ^own
+	if capturesOnly {
+		targets = enemy
+	}
+
+	add := func(from int, targets Bitboard) {
+		for targets != 0 {
+			moves = append(moves, newBitMove(from, targets.pop()))
+		}
+	}
+
+	for bb := pcs[Knight]; bb != 0; {
+		from := bb.pop()
+		add(from, knightAttacks[from]&targets)
+	}
+	for bb := pcs[Bishop] | pcs[Queen]; bb != 0; {
+		from := bb.pop()
+		add(from, bishopAttacks(from, p.occupied)&targets)
+	}
+	for bb := pcs[Rook] | pcs[Queen]; bb != 0; {
+		from := bb.pop()
+		add(from, rookAttacks(from, p.occupied)&targets)
+	}
+	for bb := pcs[King]; bb != 0; {
+		from := bb.pop()
+		add(from, kingAttacks[from]&targets)
+	}
+
+	// Pawns move towards row 0 if White, towards row 7 if Black.
+	forward, startRow, promotionRow := -8, 6, 0
+	if us == Black {
+		forward, startRow, promotionRow = 8, 1, 7
+	}
+	addPawn := func(from, to int) {
+		m := newBitMove(from, to)
+		if to/8 != promotionRow {
+			moves = append(moves, m)
+			return
+		}
+		if capturesOnly {
+			moves = append(moves, m.withPromotion(Queen))
+			return
+		}
+		for _, pt := range promotionTypes {
+			moves = append(moves, m.withPromotion(pt))
+		}
+	}
+	captures := enemy
+	if p.ep != noSquare {
+		captures |= squareBB(int(p.ep))
+	}
+	for bb := pcs[Pawn]; bb != 0; {
+		from := bb.pop()
+		for targets := pawnAttacks[us][from] & captures; targets != 0; {
+			addPawn(from, targets.pop())
+		}
+		to := from + forward
+		if p.occupied&squareBB(to) != 0 || (capturesOnly && to/8 != promotionRow) {
+			continue
+		}
+		addPawn(from, to)
+		if !capturesOnly && from/8 == startRow && p.occupied&squareBB(to+forward) == 0 {
+			moves = append(moves, newBitMove(from, to+forward))
+		}
+	}
+
+	if !capturesOnly {
+		p.generateCastling(&moves)
+	}
+	return moves
+}
+
+func (p *BitPosition) generateCastling(moves *[]bitMove) {
+	kingside, queenside, king := castleWhiteKingside, castleWhiteQueenside, 60
+	if p.turn == Black {
+		kingside, queenside, king = castleBlackKingside, castleBlackQueenside, 4
+	}
+	if p.castling&(kingside|queenside) == 0 {
+		return
+	}
+	them := opposite(p.turn)
+	safe := func(squares ...int) bool {
+		for _, sq := range squares {
+			if p.attacked(sq, them, p.occupied) {
+				return false
+			}
+		}
+		return true
+	}
+	empty := func(squares ...int) bool {
+		for _, sq := range squares {
+			if p.occupied&squareBB(sq) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if p.castling&kingside != 0 && empty(king+1, king+2) && safe(king, king+1, king+2) {
+		*moves = append(*moves, newBitMove(king, king+2))
+	}
+	if p.castling&queenside != 0 && empty(king-1, king-2, king-3) && safe(king, king-1, king-2) {
+		*moves = append(*moves, newBitMove(king, king-2))
+	}
+}
+
+// legalMoves returns the legal moves of the side to move.
+func (p *BitPosition) legalMoves() []bitMove {
+	pseudo := p.generateMoves(make([]bitMove, 0, 64))
+	legal := pseudo[:0]
+	for _, m := range pseudo {
+		child := *p
+		child.makeMove(m)
+		if !child.inCheck(p.turn) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
@@ -0,0 +1,189 @@
+package chess
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// polyglotKey returns the Polyglot hash of the current position of the
+// game.
+func polyglotKey(game *Game) uint64 {
+	var h uint64
+	board := game.board
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			p := board[r][c]
+			if p == nil {
+				continue
+			}
+			// Polyglot orders the pieces pawn to king, black before white,
+			// and the rows from rank 1.
+			kind := 2*(5-int(p.pieceType)) + 1 - int(p.color)
+			h ^= polyglotRandom[64*kind+8*(7-r)+c]
+		}
+	}
+	mask := castlingMask(board)
+	for i := 0; i < 4; i++ {
+		if mask&(1<<i) != 0 {
+			h ^= polyglotRandom[768+i]
+		}
+	}
+	// The en passant file only counts if a pawn of the side to move
+	// stands next to the pawn that has made the double step.
+	if ep := game.enPassant; ep != nil {
+		row := ep.Row + 1
+		if game.turn == Black {
+			row = ep.Row - 1
+		}
+		for _, c := range []int{ep.Col - 1, ep.Col + 1} {
+			if c < 0 || c > 7 {
+				continue
+			}
+			if p := board[row][c]; p != nil && p.pieceType == Pawn && p.color == game.turn {
+				h ^= polyglotRandom[772+ep.Col]
+				break
+			}
+		}
+	}
+	if game.turn == White {
+		h ^= polyglotRandom[780]
+	}
+	return h
+}
+
+// PolyglotBook is an opening book in the Polyglot .bin format.
+type PolyglotBook struct {
+	entries []bookEntry // sorted by key
+}
+
+type bookEntry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+}
+
+// BookMove is a move of an opening book with its weight.
+type BookMove struct {
+	Move   Move
+	Weight int
+}
+
+// OpenBook reads a Polyglot book file.
+func OpenBook(path string) (*PolyglotBook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBook(bufio.NewReader(f))
+}
+
+// ReadBook reads a Polyglot book: a sequence of 16 byte big-endian entries
+// of key, move, weight and learn value, sorted by key.
+func ReadBook(r io.Reader) (*PolyglotBook, error) {
+	book := &PolyglotBook{}
+	var buf [16]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid Polyglot book: %v", err)
+		}
+		book.entries = append(book.entries, bookEntry{
+			key:    binary.BigEndian.Uint64(buf[0:8]),
+			move:   binary.BigEndian.Uint16(buf[8:10]),
+			weight: binary.BigEndian.Uint16(buf[10:12]),
+		})
+	}
+	sort.SliceStable(book.entries, func(i, j int) bool {
+		return book.entries[i].key < book.entries[j].key
+	})
+	return book, nil
+}
+
+// Moves returns the legal book moves of the current position, the highest
+// weight first.
+func (b *PolyglotBook) Moves(game *Game) []BookMove {
+	key := polyglotKey(game)
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].key >= key })
+	legal := GenerateLegalMoves(game)
+	var moves []BookMove
+	for ; i < len(b.entries) && b.entries[i].key == key; i++ {
+		if m, ok := decodeBookMove(game.board, legal, b.entries[i].move); ok {
+			moves = append(moves, BookMove{Move: m, Weight: int(b.entries[i].weight)})
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].Weight > moves[j].Weight })
+	return moves
+}
+
+// Pick chooses a book move for the current position: the one with the
+// highest weight if best is set, otherwise a random one with a probability
+// proportional to its weight. ok is false if the position is not in the
+// book.
+func (b *PolyglotBook) Pick(game *Game, best bool, rnd *rand.Rand) (m Move, ok bool) {
+	moves := b.Moves(game)
+	if len(moves) == 0 {
+		return Move{}, false
+	}
+	total := 0
+	for _, bm := range moves {
+		total += bm.Weight
+	}
+	if best || total == 0 {
+		return moves[0].Move, true
+	}
+	n := rnd.Intn(total)
+	for _, bm := range moves {
+		if n < bm.Weight {
+			return bm.Move, true
+		}
+		n -= bm.Weight
+	}
+	return moves[0].Move, true
+}
+
+// decodeBookMove finds the legal move of a Polyglot move: the to file in
+// bits 0-2, the to row in bits 3-5, the from file and row in bits 6-11 and
+// the promotion piece in bits 12-14, rows counted from rank 1. Castling is
+// written as the king capturing its own rook.
+func decodeBookMove(board *Board, legal []Move, bm uint16) (Move, bool) {
+	from := Position{Row: 7 - int(bm>>9&7), Col: int(bm >> 6 & 7)}
+	to := Position{Row: 7 - int(bm>>3&7), Col: int(bm & 7)}
+	var promotion PieceType
+	switch bm >> 12 & 7 {
+	case 0:
+	case 1:
+		promotion = Knight
+	case 2:
+		promotion = Bishop
+	case 3:
+		promotion = Rook
+	case 4:
+		promotion = Queen
+	default:
+		return Move{}, false
+	}
+	isPromotion := bm>>12&7 != 0
+
+	if p := board[from.Row][from.Col]; p != nil && p.pieceType == King && from.Col == 4 {
+		if rook := board[to.Row][to.Col]; rook != nil && rook.pieceType == Rook && rook.color == p.color {
+			if to.Col == 7 {
+				to.Col = 6
+			} else if to.Col == 0 {
+				to.Col = 2
+			}
+		}
+	}
+	for _, m := range legal {
+		if m.from == from && m.to == to && m.isPromotion == isPromotion && (!isPromotion || m.promotion == promotion) {
+			return m, true
+		}
+	}
+	return Move{}, false
+}
@@ -0,0 +1,84 @@
+package chess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestPolyglotKey(t *testing.T) {
+	// The positions of the Polyglot book format description.
+	tests := []struct {
+		moves string
+		key   uint64
+	}{
+		{"", 0x463B96181691FC9C},
+		{"e2e4", 0x823C9B50FD114196},
+		{"e2e4 d7d5", 0x0756B94461C50FB0},
+		{"e2e4 d7d5 e4e5", 0x662FAFB965DB29D4},
+		{"e2e4 d7d5 e4e5 f7f5", 0x22A48B5A8E47FF78},
+		{"e2e4 d7d5 e4e5 f7f5 e1e2", 0x652A607CA3F242C1},
+		{"e2e4 d7d5 e4e5 f7f5 e1e2 e8f7", 0x00FDD303C946BDD9},
+		{"a2a4 b7b5 h2h4 b5b4 c2c4", 0x3C8123EA7B067637},
+		{"a2a4 b7b5 h2h4 b5b4 c2c4 b4c3 a1a3", 0x5C3F9B829B279560},
+		// The black queen on the seventh rank.
+		{"e2e4 d7d5 e4e5 f7f5 e1e2 e8f7 a2a3 d8d7", 0xD6F2A7F379ACE6D6},
+	}
+	for _, tc := range tests {
+		game := NewGame()
+		for _, s := range strings.Fields(tc.moves) {
+			m, err := ParseUCIMove(game, s)
+			if err == nil {
+				err = game.MakeMove(m)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if key := polyglotKey(game); key != tc.key {
+			t.Errorf("%q: got %016X, want %016X", tc.moves, key, tc.key)
+		}
+	}
+}
+
+// bookEntryBytes encodes a Polyglot book entry with a learn value of 0.
+func bookEntryBytes(key uint64, move, weight uint16) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[0:8], key)
+	binary.BigEndian.PutUint16(b[8:10], move)
+	binary.BigEndian.PutUint16(b[10:12], weight)
+	return b
+}
+
+func TestBookMoves(t *testing.T) {
+	tests := []struct {
+		fen  string
+		move uint16 // from row, from file, to row, to file, rows from rank 1
+		want string
+	}{
+		{"", 1<<9 | 4<<6 | 3<<3 | 4, "e2e4"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", 0<<9 | 4<<6 | 0<<3 | 7, "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", 7<<9 | 4<<6 | 7<<3 | 0, "e8c8"},
+		{"8/P7/8/8/8/8/k7/4K3 w - - 0 1", 4<<12 | 6<<9 | 0<<6 | 7<<3 | 0, "a7a8q"},
+		{"8/P7/8/8/8/8/k7/4K3 w - - 0 1", 1<<12 | 6<<9 | 0<<6 | 7<<3 | 0, "a7a8n"},
+	}
+	for _, tc := range tests {
+		game := NewGame()
+		if tc.fen != "" {
+			var err error
+			if game, err = ParseFEN(tc.fen); err != nil {
+				t.Fatal(err)
+			}
+		}
+		key := polyglotKey(game)
+		book, err := ReadBook(bytes.NewReader(bookEntryBytes(key, tc.move, 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		moves := book.Moves(game)
+		if len(moves) != 1 || moves[0].Move.UCI() != tc.want {
+			t.Errorf("%s: got %v, want %s", tc.fen, moves, tc.want)
+		}
+	}
+}
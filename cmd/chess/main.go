@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/wlbr/chess"
 
@@ -15,13 +21,66 @@ const (
 	messageRow    = boardHeight + 1
 	messageHeight = 4
 	AI_NAME       = "RabbitAI"
+	aiMoveTime    = 2 * time.Second // the skill levels below the maximum search less
+	pgnFilename   = "game.pgn"
 )
 
 var game *chess.Game
 
+// difficulties are the strengths of the AI the menu offers.
+var difficulties = []struct {
+	name  string
+	skill chess.Skill
+}{
+	{"Beginner", 0},
+	{"Easy", 5},
+	{"Medium", 10},
+	{"Hard", 15},
+	{"Maximum", chess.MaxSkill},
+}
+
+// Strength of the AI, the index of the chosen one in difficulties.
+var (
+	difficulty = len(difficulties) - 1
+	skillRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// endgameStatus tells in the menu how loading the endgame tables of
+// -endgamepath goes, nil without them.
+var endgameStatus atomic.Pointer[string]
+
+// Opening book of the AI, nil unless enabled with -ownbook.
+var (
+	book     *chess.PolyglotBook
+	bookBest bool
+	bookRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
 func main() {
+	ownBook := flag.Bool("ownbook", false, "Let the AI play the opening from a Polyglot book")
+	bookFile := flag.String("bookfile", "book.bin", "Polyglot opening book")
+	flag.BoolVar(&bookBest, "bookbest", false, "Always play the book move with the highest weight")
+	syzygyPath := flag.String("syzygypath", "", "Directories with Syzygy endgame tablebases")
+	endgamePath := flag.String("endgamepath", "", "Directory of the generated DTM endgame tables")
 	chess.Configure()
 
+	if err := chess.SetSyzygyPath(*syzygyPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *endgamePath != "" {
+		go openEndgames(*endgamePath)
+	}
+
+	if *ownBook {
+		b, err := chess.OpenBook(*bookFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		book = b
+	}
+
 	err := termbox.Init()
 	if err != nil {
 		panic(err)
@@ -36,6 +95,10 @@ func main() {
 			playVSPlayer()
 		case '2':
 			playAgainstAI()
+		case '3':
+			continueFromPGN()
+		case '4':
+			difficulty = (difficulty + 1) % len(difficulties)
 		case 'q':
 			return
 		}
@@ -56,7 +119,10 @@ func drawMenu() {
 	msg1 := "Choose game mode:"
 	msg2 := "1. Player vs Player"
 	msg3 := "2. Player vs AI"
-	msg4 := "q. Quit"
+	msg4 := "3. Continue game from " + pgnFilename
+	d := difficulties[difficulty]
+	msg5 := fmt.Sprintf("4. AI difficulty: %s (about %d Elo)", d.name, d.skill.Elo())
+	msg6 := "q. Quit"
 	for i, r := range msg1 {
 		termbox.SetCell(i, 0, r, termbox.ColorWhite, termbox.ColorDefault)
 	}
@@ -69,9 +135,35 @@ func drawMenu() {
 	for i, r := range msg4 {
 		termbox.SetCell(i, 4, r, termbox.ColorWhite, termbox.ColorDefault)
 	}
+	for i, r := range msg5 {
+		termbox.SetCell(i, 5, r, termbox.ColorWhite, termbox.ColorDefault)
+	}
+	for i, r := range msg6 {
+		termbox.SetCell(i, 6, r, termbox.ColorWhite, termbox.ColorDefault)
+	}
+	if status := endgameStatus.Load(); status != nil {
+		for i, r := range "Endgame tables: " + *status {
+			termbox.SetCell(i, 8, r, termbox.ColorWhite, termbox.ColorDefault)
+		}
+	}
 	termbox.Flush()
 }
 
+// openEndgames loads the endgame tables of dir for the AI. Missing tables
+// are generated first, which takes about half a minute, so it runs in the
+// background and the AI plays without the tables until they are ready.
+func openEndgames(dir string) {
+	status := func(s string) { endgameStatus.Store(&s) }
+	status("generating in " + dir)
+	e, err := chess.OpenEndgames(dir, chess.DefaultEndgames...)
+	if err != nil {
+		status(err.Error())
+		return
+	}
+	chess.SetEndgames(e)
+	status("ready")
+}
+
 func playVSPlayer() {
 	game = chess.NewGame()
 	gameLoop(false)
@@ -80,9 +172,41 @@ func playVSPlayer() {
 func playAgainstAI() {
 	game = chess.NewGame()
 	game.SetVsAI(true)
+	chess.ClearHash()
 	gameLoop(true)
 }
 
+func continueFromPGN() {
+	file, err := os.Open(pgnFilename)
+	if err != nil {
+		showMenuError(fmt.Sprintf("Error opening file: %s", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	games, err := chess.ParsePGN(file)
+	if err != nil {
+		showMenuError(fmt.Sprintf("Error reading file: %s", err.Error()))
+		return
+	}
+	if len(games) == 0 {
+		showMenuError(fmt.Sprintf("No game found in %s", pgnFilename))
+		return
+	}
+
+	game = games[0].Game()
+	game.SetVsAI(games[0].Tag("Black") == AI_NAME)
+	chess.ClearHash()
+	gameLoop(game.VsAI())
+}
+
+func showMenuError(msg string) {
+	drawMenu()
+	drawMessages(msg, "Press any key to continue.")
+	termbox.Flush()
+	waitForModeChoice()
+}
+
 func gameLoop(ai bool) {
 	for {
 		drawEverything()
@@ -92,9 +216,14 @@ func gameLoop(ai bool) {
 		}
 
 		if ai && game.Turn() == chess.Black {
-			from, to := chess.FindBestMove(game, 3)
-			piece := game.Board().PieceAt(from.Row, from.Col)
-			finalizeMove(from, to, *piece, nil)
+			r, ok := thinkAI()
+			if !ok {
+				return
+			}
+			finalizeMove(r.Move)
+			if r.Mate > 0 {
+				game.SetStatus(fmt.Sprintf("%s %s announces mate in %d.", game.Status(), AI_NAME, r.Mate))
+			}
 			continue
 		}
 
@@ -103,6 +232,8 @@ func gameLoop(ai bool) {
 			switch ev.Ch {
 			case 'e':
 				handleExport()
+			case 'd':
+				game.ClaimDraw()
 			}
 			switch ev.Key {
 			case termbox.KeyEsc:
@@ -122,6 +253,43 @@ func gameLoop(ai bool) {
 	}
 }
 
+// thinkAI plays a book move if there is one and otherwise searches the
+// AI's move in the background. Space makes the AI play the best move found
+// so far, Esc aborts the search and the game.
+func thinkAI() (chess.SearchResult, bool) {
+	if book != nil {
+		if m, ok := book.Pick(game, bookBest, bookRand); ok {
+			return chess.SearchResult{Move: m, PV: []chess.Move{m}}, true
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan chess.SearchResult, 1)
+	go func() {
+		skill := difficulties[difficulty].skill
+		result <- skill.Search(ctx, game, chess.SearchLimits{MoveTime: aiMoveTime}, skillRand, nil)
+		termbox.Interrupt()
+	}()
+
+	drawMessages(game.Status(), AI_NAME+" is thinking... (Space: move now, Esc: quit)")
+	termbox.Flush()
+	for {
+		ev := termbox.PollEvent()
+		switch {
+		case ev.Type == termbox.EventInterrupt:
+			r := <-result
+			return r, r.PV != nil
+		case ev.Type == termbox.EventKey && ev.Key == termbox.KeySpace:
+			cancel()
+		case ev.Type == termbox.EventKey && ev.Key == termbox.KeyEsc:
+			cancel()
+			<-result
+			return chess.SearchResult{}, false
+		}
+	}
+}
+
 func drawEverything() {
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 	drawBoard()
@@ -131,17 +299,8 @@ func drawEverything() {
 }
 
 func handleEndGameConditions() bool {
-	var msg string
-	if chess.IsCheckmate(game.Board(), game.MoveLog(), game.Turn()) {
-		msg = "Checkmate!"
-	} else if chess.IsStalemate(game.Board(), game.MoveLog(), game.Turn()) {
-		msg = "Stalemate!"
-	} else if chess.IsThreefoldRepetition(game.BoardHistory()) {
-		msg = "Threefold repetition!"
-	}
-
-	if msg != "" {
-		game.SetStatus(msg)
+	if outcome := game.Outcome(); outcome.Result != chess.Ongoing {
+		game.SetStatus(outcome.String() + "!")
 		drawEverything()
 		drawMessages(game.Status(), "Export to PGN? (y/n)")
 		termbox.Flush()
@@ -190,13 +349,13 @@ func doExportPGN() string {
 		return "No game to export."
 	}
 
-	filename := "game.pgn"
+	filename := pgnFilename
 	white := "Player 1"
 	black := "Player 2"
 	if game.VsAI() {
 		black = AI_NAME
 	}
-	pgn := chess.ExportToPGN(game.MoveLog(), white, black)
+	pgn := chess.ExportGameToPGN(game, white, black)
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Sprintf("Error creating file: %s", err.Error())
@@ -252,89 +411,45 @@ func selectPiece() {
 			return
 		}
 
-		if chess.IsValidMove(game.Board(), game.MoveLog(), from, to) {
-			piece := game.Board().PieceAt(from.Row, from.Col)
-			var promotion *chess.PieceType
+		// The promotion piece is only asked for once the move is known to
+		// be legal; any piece will do to check that.
+		queen := chess.Queen
+		if _, ok := game.LegalMove(from, to, &queen); !ok {
+			return
+		}
+		piece := game.Board().PieceAt(from.Row, from.Col)
+		var promotion *chess.PieceType
 
-			if piece.Type() == chess.Pawn && (to.Row == 0 || to.Row == 7) {
-				promoType := promptForPromotion()
-				promotion = &promoType
-			}
-			finalizeMove(from, to, *piece, promotion)
+		if piece.Type() == chess.Pawn && (to.Row == 0 || to.Row == 7) {
+			promoType := promptForPromotion()
+			promotion = &promoType
+		}
+		if move, ok := game.LegalMove(from, to, promotion); ok {
+			finalizeMove(move)
 		}
 	}
 }
 
-func finalizeMove(from, to chess.Position, piece chess.Piece, promotion *chess.PieceType) {
-	// Clone board to check for check
-	tempBoard := game.Board().Clone()
-	pieceAtTo := tempBoard.PieceAt(to.Row, to.Col)
-	isCapture := pieceAtTo != nil
-
-	// --- Make all moves on the temporary board ---
-	tempBoard.MovePiece(from, to)
-	movedPiece := tempBoard.PieceAt(to.Row, to.Col)
-	movedPiece.SetHasMoved(true)
-
-	// Handle en passant capture
-	if piece.Type() == chess.Pawn && to.Col != from.Col && pieceAtTo == nil {
-		isCapture = true
-		if piece.Color() == chess.White {
-			tempBoard.SetPieceAt(to.Row+1, to.Col, nil)
-		} else {
-			tempBoard.SetPieceAt(to.Row-1, to.Col, nil)
-		}
+// finalizeMove plays a legal move and updates the status message.
+func finalizeMove(move chess.Move) {
+	if err := game.MakeMove(move); err != nil {
+		return
 	}
-
-	// Handle promotion
-	if promotion != nil {
-		movedPiece.SetType(*promotion)
+	status := ""
+	if chess.IsCheck(game.Board(), game.MoveLog(), game.Turn()) {
+		status = "Check! "
 	}
-
-	// Handle castling
-	if piece.Type() == chess.King && chess.Abs(to.Col-from.Col) == 2 {
-		var rookFrom, rookTo chess.Position
-		if to.Col > from.Col { // Kingside
-			rookFrom = chess.Position{Row: to.Row, Col: 7}
-			rookTo = chess.Position{Row: to.Row, Col: to.Col - 1}
-		} else { // Queenside
-			rookFrom = chess.Position{Row: to.Row, Col: 0}
-			rookTo = chess.Position{Row: to.Row, Col: to.Col + 1}
-		}
-		tempBoard.MovePiece(rookFrom, rookTo)
-		rook := tempBoard.PieceAt(rookTo.Row, rookTo.Col)
-		rook.SetHasMoved(true)
-	}
-
-	// --- Validate and commit the move ---
-	if !chess.IsCheck(tempBoard, game.MoveLog(), game.Turn()) {
-		// Determine check/checkmate status AFTER the move
-		var checkStatus string
-		opponentColor := chess.White
-		if game.Turn() == chess.White {
-			opponentColor = chess.Black
-		}
-		if chess.IsCheckmate(tempBoard, game.MoveLog(), opponentColor) {
-			checkStatus = "++"
-		} else if chess.IsCheck(tempBoard, game.MoveLog(), opponentColor) {
-			checkStatus = "+"
-		}
-
-		game.MoveLog().AddMove(from, to, piece, isCapture, checkStatus)
-		game.SetBoard(tempBoard)
-		game.AddToBoardHistory(game.Board().Clone())
-		// Switch turn and update status message
-		if game.Turn() == chess.White {
-			game.SetTurn(chess.Black)
-		} else {
-			game.SetTurn(chess.White)
-		}
-		if checkStatus == "+" || checkStatus == "++" {
-			game.SetStatus("Check!")
-		} else {
-			game.SetStatus("")
+	if reason := game.ClaimableDraw(); reason != chess.NoTermination {
+		status += fmt.Sprintf("Draw by %s can be claimed (d).", reason)
+		if reason == chess.Repetition {
+			var plies []string
+			for _, ply := range game.RepetitionPlies() {
+				plies = append(plies, strconv.Itoa(ply))
+			}
+			status += fmt.Sprintf(" Position repeated from plies %s.", strings.Join(plies, ", "))
 		}
 	}
+	game.SetStatus(status)
 }
 
 func promptForPromotion() chess.PieceType {
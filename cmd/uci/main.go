@@ -2,61 +2,445 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"math/rand"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/wlbr/chess"
 )
 
-var game *chess.Game
+const (
+	engineName   = "RabbitAI"
+	engineAuthor = "wlbr"
+
+	maxHash    = 1024
+	maxThreads = 256
+)
+
+// goParams holds the parameters of a "go" command.
+type goParams struct {
+	limits   chess.SearchLimits
+	infinite bool
+}
+
+type engine struct {
+	game *chess.Game
+
+	// Playing strength: the skill level, or the one of elo if
+	// limitStrength is set.
+	skill         chess.Skill
+	limitStrength bool
+	elo           int
+	skillRand     *rand.Rand
+
+	// Opening book, used if ownBook is set and the book could be read.
+	ownBook  bool
+	bookBest bool
+	bookFile string
+	book     *chess.PolyglotBook
+	bookRand *rand.Rand
+
+	// Directory of the endgame tables, which are opened in the background.
+	endgameMu  sync.Mutex
+	endgameDir string
+
+	out sync.Mutex
+
+	// cancel ends the running search, done is closed by the search once
+	// it has sent its bestmove.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
 
 func main() {
 	chess.Configure()
 
+	e := &engine{
+		game:      chess.NewGame(),
+		skill:     chess.MaxSkill,
+		elo:       chess.MaxElo,
+		skillRand: rand.New(rand.NewSource(time.Now().UnixNano())),
+		bookRand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
+		parts := strings.Fields(scanner.Text())
 		if len(parts) == 0 {
 			continue
 		}
 
 		switch parts[0] {
 		case "uci":
-			fmt.Println("id name MyChessEngine")
-			fmt.Println("id author Your Name")
-			fmt.Println("uciok")
+			e.send("id name %s", engineName)
+			e.send("id author %s", engineAuthor)
+			e.send("option name Hash type spin default %d min 1 max %d", chess.DefaultHashSize, maxHash)
+			e.send("option name Threads type spin default %d min 1 max %d", chess.DefaultThreads, maxThreads)
+			e.send("option name Skill Level type spin default %d min 0 max %d", chess.MaxSkill, chess.MaxSkill)
+			e.send("option name UCI_LimitStrength type check default false")
+			e.send("option name UCI_Elo type spin default %d min %d max %d", chess.MaxElo, chess.MinElo, chess.MaxElo)
+			e.send("option name OwnBook type check default false")
+			e.send("option name BookFile type string default <empty>")
+			e.send("option name BookBestOnly type check default false")
+			e.send("option name SyzygyPath type string default <empty>")
+			e.send("option name EndgamePath type string default <empty>")
+			e.send("uciok")
 		case "isready":
-			fmt.Println("readyok")
+			e.send("readyok")
+		case "setoption":
+			// The search uses the settings, so changing them waits
+			// for it to end.
+			e.stopSearch()
+			e.setOption(parts[1:])
 		case "ucinewgame":
-			game = chess.NewGame()
+			e.stopSearch()
+			e.game = chess.NewGame()
+			chess.ClearHash()
 		case "position":
-			if len(parts) > 1 {
-				switch parts[1] {
-				case "startpos":
-					game = chess.NewGame()
-					if len(parts) > 2 && parts[2] == "moves" {
-						for _, moveStr := range parts[3:] {
-							move := chess.AlgebraicToMove(game.Board(), moveStr)
-							game.Board().MovePiece(move.From(), move.To())
-						}
-					}
-				case "fen":
-					// TODO: implement fen
-				}
-			}
+			e.stopSearch()
+			e.position(parts[1:])
 		case "go":
-			from, to := chess.FindBestMove(game, 5) // Using a depth of 5 for the UCI
-			piece := game.Board().PieceAt(from.Row, from.Col)
-			isCapture := game.Board().PieceAt(to.Row, to.Col) != nil
-			move := chess.NewMove(from, to, *piece, isCapture, "")
-			fmt.Printf("bestmove %s\n", move.Notation())
-
+			e.stopSearch()
+			if len(parts) > 2 && parts[1] == "perft" {
+				e.perft(parts[2])
+				continue
+			}
+			e.startSearch(parseGo(parts[1:]))
 		case "stop":
-			// TODO: implement stop command
+			e.stopSearch()
 		case "quit":
+			e.stopSearch()
 			return
 		}
 	}
 }
+
+func (e *engine) send(format string, args ...interface{}) {
+	e.out.Lock()
+	defer e.out.Unlock()
+	fmt.Printf(format+"\n", args...)
+}
+
+// setOption handles "setoption name <id> [value <x>]".
+func (e *engine) setOption(args []string) {
+	var name, value []string
+	target := &name
+	for _, a := range args {
+		switch a {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			*target = append(*target, a)
+		}
+	}
+
+	n, err := strconv.Atoi(strings.Join(value, " "))
+	b, berr := strconv.ParseBool(strings.Join(value, " "))
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "hash":
+		if err == nil && n >= 1 && n <= maxHash {
+			chess.SetHashSize(n)
+			return
+		}
+	case "threads":
+		if err == nil && n >= 1 && n <= maxThreads {
+			chess.SetThreads(n)
+			return
+		}
+	case "skill level":
+		if err == nil && n >= 0 && n <= int(chess.MaxSkill) {
+			e.skill = chess.Skill(n)
+			return
+		}
+	case "uci_limitstrength":
+		if berr == nil {
+			e.limitStrength = b
+			return
+		}
+	case "uci_elo":
+		if err == nil && n >= chess.MinElo && n <= chess.MaxElo {
+			e.elo = n
+			return
+		}
+	case "ownbook":
+		if berr == nil {
+			e.ownBook = b
+			return
+		}
+	case "bookbestonly":
+		if berr == nil {
+			e.bookBest = b
+			return
+		}
+	case "bookfile":
+		e.bookFile = optionPath(value)
+		e.loadBook()
+		return
+	case "syzygypath":
+		if err := chess.SetSyzygyPath(optionPath(value)); err != nil {
+			e.send("info string %s", err)
+		}
+		return
+	case "endgamepath":
+		e.openEndgames(optionPath(value))
+		return
+	default:
+		e.send("info string unknown option %q", strings.Join(name, " "))
+		return
+	}
+	e.send("info string invalid value %q for option %q", strings.Join(value, " "), strings.Join(name, " "))
+}
+
+// optionPath returns the value of a string option, "<empty>" being empty.
+func optionPath(value []string) string {
+	if v := strings.Join(value, " "); v != "<empty>" {
+		return v
+	}
+	return ""
+}
+
+// loadBook reads the opening book of the BookFile option.
+func (e *engine) loadBook() {
+	e.book = nil
+	if e.bookFile == "" {
+		return
+	}
+	book, err := chess.OpenBook(e.bookFile)
+	if err != nil {
+		e.send("info string %s", err)
+		return
+	}
+	e.book = book
+}
+
+// openEndgames loads the DTM endgame tables from dir, or disables them if
+// dir is empty. Generating missing tables takes a while, so it happens in
+// the background and the engine plays without the tables until they are
+// ready.
+func (e *engine) openEndgames(dir string) {
+	e.endgameMu.Lock()
+	e.endgameDir = dir
+	e.endgameMu.Unlock()
+	chess.SetEndgames(nil)
+	if dir == "" {
+		return
+	}
+	go func() {
+		tables, err := chess.OpenEndgames(dir, chess.DefaultEndgames...)
+		if err != nil {
+			e.send("info string %s", err)
+			return
+		}
+		e.endgameMu.Lock()
+		defer e.endgameMu.Unlock()
+		// The option may have been changed in the meantime.
+		if e.endgameDir == dir {
+			chess.SetEndgames(tables)
+			e.send("info string endgame tables ready")
+		}
+	}()
+}
+
+// position handles "position [startpos | fen <fen>] [moves <move>...]".
+func (e *engine) position(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	var game *chess.Game
+	var moves []string
+	switch args[0] {
+	case "startpos":
+		game = chess.NewGame()
+		args = args[1:]
+	case "fen":
+		end := len(args)
+		for i, a := range args {
+			if a == "moves" {
+				end = i
+				break
+			}
+		}
+		g, err := chess.ParseFEN(strings.Join(args[1:end], " "))
+		if err != nil {
+			e.send("info string %s", err)
+			return
+		}
+		game = g
+		args = args[end:]
+	default:
+		return
+	}
+	if len(args) > 0 && args[0] == "moves" {
+		moves = args[1:]
+	}
+
+	// An illegal move ends the list: the position is set up up to the
+	// last legal move rather than keeping the previous one.
+	e.game = game
+	for _, moveStr := range moves {
+		move, err := chess.ParseUCIMove(game, moveStr)
+		if err == nil {
+			err = game.MakeMove(move)
+		}
+		if err != nil {
+			e.send("info string %s", err)
+			return
+		}
+	}
+}
+
+// perft handles the non-standard "go perft <depth>" command: it prints the
+// perft count below each legal move and the total.
+func (e *engine) perft(arg string) {
+	depth, err := strconv.Atoi(arg)
+	if err != nil || depth < 1 {
+		e.send("info string invalid perft depth %q", arg)
+		return
+	}
+	start := time.Now()
+	divide := chess.PerftDivide(e.game, depth)
+	moves := make([]string, 0, len(divide))
+	for m := range divide {
+		moves = append(moves, m)
+	}
+	sort.Strings(moves)
+
+	var total uint64
+	for _, m := range moves {
+		e.send("%s: %d", m, divide[m])
+		total += divide[m]
+	}
+	e.send("")
+	e.send("Nodes searched: %d (%d ms)", total, time.Since(start).Milliseconds())
+}
+
+func parseGo(args []string) goParams {
+	var p goParams
+	l := &p.limits
+	for i := 0; i < len(args); i++ {
+		next := func() int {
+			if i+1 >= len(args) {
+				return 0
+			}
+			i++
+			n, _ := strconv.Atoi(args[i])
+			return n
+		}
+		ms := func() time.Duration {
+			return time.Duration(next()) * time.Millisecond
+		}
+
+		switch args[i] {
+		case "wtime":
+			l.WhiteTime = ms()
+		case "btime":
+			l.BlackTime = ms()
+		case "winc":
+			l.WhiteInc = ms()
+		case "binc":
+			l.BlackInc = ms()
+		case "movestogo":
+			l.MovesToGo = next()
+		case "depth":
+			l.Depth = next()
+		case "nodes":
+			l.Nodes = uint64(next())
+		case "movetime":
+			l.MoveTime = ms()
+		case "infinite":
+			p.infinite = true
+		}
+	}
+	if p.infinite {
+		p.limits = chess.SearchLimits{}
+	}
+	return p
+}
+
+// strength returns the skill level to play at.
+func (e *engine) strength() chess.Skill {
+	if e.limitStrength {
+		return chess.SkillForElo(e.elo)
+	}
+	return e.skill
+}
+
+// startSearch runs the search in the background. It answers with the best
+// move of the last completed iteration once a limit is reached or
+// stopSearch is called.
+func (e *engine) startSearch(p goParams) {
+	game := e.game
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	e.cancel, e.done = cancel, done
+	skill := e.strength()
+
+	if e.ownBook && e.book != nil {
+		if m, ok := e.book.Pick(game, e.bookBest, e.bookRand); ok {
+			go func() {
+				defer close(done)
+				if p.infinite {
+					<-ctx.Done()
+				}
+				e.send("info string book move")
+				e.sendBestMove(chess.SearchResult{Move: m, PV: []chess.Move{m}})
+			}()
+			return
+		}
+	}
+
+	go func() {
+		defer close(done)
+		start := time.Now()
+		best := skill.Search(ctx, game, p.limits, e.skillRand, func(r chess.SearchResult) {
+			e.sendInfo(r, time.Since(start))
+		})
+		if p.infinite {
+			<-ctx.Done()
+		}
+		e.sendBestMove(best)
+	}()
+}
+
+// stopSearch ends the running search, if any, and waits for its bestmove.
+func (e *engine) stopSearch() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+	e.cancel, e.done = nil, nil
+}
+
+func (e *engine) sendInfo(r chess.SearchResult, elapsed time.Duration) {
+	pv := make([]string, len(r.PV))
+	for i := range r.PV {
+		pv[i] = r.PV[i].UCI()
+	}
+	ms := elapsed.Milliseconds()
+	nps := uint64(0)
+	if ms > 0 {
+		nps = r.Nodes * 1000 / uint64(ms)
+	}
+	score := fmt.Sprintf("cp %d", r.Score)
+	if r.Mate != 0 {
+		score = fmt.Sprintf("mate %d", r.Mate)
+	}
+	e.send("info depth %d score %s nodes %d nps %d tbhits %d time %d pv %s", r.Depth, score, r.Nodes, nps, r.Stats.TablebaseHits, ms, strings.Join(pv, " "))
+}
+
+func (e *engine) sendBestMove(r chess.SearchResult) {
+	if r.PV == nil {
+		e.send("bestmove 0000")
+		return
+	}
+	e.send("bestmove %s", r.Move.UCI())
+}
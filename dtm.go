@@ -0,0 +1,754 @@
+package chess
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Distance to mate (DTM) tables of endings with few pieces, built by
+// retrograde analysis: starting from the checkmates, positions are solved
+// backwards one ply at a time by taking moves back.
+
+// DefaultEndgames are the endings OpenEndgames is usually asked for.
+var DefaultEndgames = []string{"KQK", "KRK", "KPK", "KBNK", "KQKR"}
+
+// dtmMaxPieces is the largest number of pieces a DTM table can have.
+const dtmMaxPieces = 4
+
+var dtmMagic = [4]byte{'C', 'D', 'T', 'M'}
+
+// DTMTable is the distance to mate table of one material, named like KQKR:
+// the pieces of the stronger side, which is called White in the table,
+// followed by the pieces of the other side. Each side has one piece of a
+// kind at most. En passant is ignored, so only one side may have pawns.
+type DTMTable struct {
+	material string
+	pieces   []dtmPiece
+	pawns    bool
+	dtm      []uint8 // plies to mate + 1, 0 for draws and unused entries
+}
+
+type dtmPiece struct {
+	color Color
+	pt    PieceType
+}
+
+// Endgames is a set of DTM tables.
+type Endgames struct {
+	tables map[string]*DTMTable
+}
+
+var endgames *Endgames
+
+// SetEndgames makes the search play the positions of the tables perfectly
+// and score the ones it reaches exactly. nil disables the tables. It waits
+// for running searches to end.
+func SetEndgames(e *Endgames) {
+	settings.Lock()
+	defer settings.Unlock()
+	endgames = e
+}
+
+// NewEndgames returns an empty set of tables.
+func NewEndgames() *Endgames {
+	return &Endgames{tables: make(map[string]*DTMTable)}
+}
+
+// OpenEndgames loads the tables of the given materials from a directory.
+// Missing tables are generated and saved there, which takes a while for
+// four pieces.
+func OpenEndgames(dir string, materials ...string) (*Endgames, error) {
+	e := NewEndgames()
+	for _, m := range materials {
+		path := filepath.Join(dir, m+".dtm")
+		if t, err := readDTMFile(path); err == nil && t.material == m {
+			e.tables[m] = t
+			continue
+		}
+		t, err := e.Generate(m)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeDTMFile(path, t); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func readDTMFile(path string) (*DTMTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDTMTable(bufio.NewReader(f))
+}
+
+func writeDTMFile(path string, t *DTMTable) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := t.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Add adds a table to the set.
+func (e *Endgames) Add(t *DTMTable) {
+	e.tables[t.material] = t
+}
+
+// Material returns the material of the table, e.g. KQKR.
+func (t *DTMTable) Material() string {
+	return t.material
+}
+
+// newDTMTable checks a material name and allocates its table.
+func newDTMTable(material string) (*DTMTable, error) {
+	split := strings.IndexByte(material[min(1, len(material)):], 'K') + 1
+	if material == "" || material[0] != 'K' || split < 1 {
+		return nil, fmt.Errorf("invalid material %q", material)
+	}
+	t := &DTMTable{material: material}
+	for i, side := range []string{material[:split], material[split:]} {
+		color := Color(i)
+		seen := map[rune]bool{}
+		for j, r := range side {
+			pt := strings.IndexRune("KQRBNP", r)
+			if pt < 0 || seen[r] || (j == 0) != (pt == int(King)) {
+				return nil, fmt.Errorf("invalid material %q", material)
+			}
+			seen[r] = true
+			t.pieces = append(t.pieces, dtmPiece{color, PieceType(pt)})
+			if pt == int(Pawn) {
+				if t.pawns && color == Black {
+					return nil, fmt.Errorf("%s: only one side may have pawns", material)
+				}
+				t.pawns = true
+			}
+		}
+	}
+	if len(t.pieces) > dtmMaxPieces {
+		return nil, fmt.Errorf("%s: at most %d pieces", material, dtmMaxPieces)
+	}
+	t.dtm = make([]uint8, t.size())
+	return t, nil
+}
+
+// Symmetries of the board: the square of sq under each of the mirrorings
+// and rotations. Tables with pawns only use the first two.
+var (
+	dtmSymmetry  [8][64]int
+	dtmKingIndex [64]int // of the squares the white king is mapped to
+	dtmKingSq    [2][]int
+)
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		r, c := sq/8, sq%8
+		images := [8][2]int{{r, c}, {r, 7 - c}, {7 - r, c}, {7 - r, 7 - c}, {c, r}, {c, 7 - r}, {7 - c, r}, {7 - c, 7 - r}}
+		for i, img := range images {
+			dtmSymmetry[i][sq] = img[0]*8 + img[1]
+		}
+	}
+	// Without pawns the white king is mapped to the triangle a8-d8-d5,
+	// with pawns to the files a-d.
+	for sq := 0; sq < 64; sq++ {
+		r, c := sq/8, sq%8
+		if r <= c && c <= 3 {
+			dtmKingIndex[sq] = len(dtmKingSq[0])
+			dtmKingSq[0] = append(dtmKingSq[0], sq)
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		if sq%8 <= 3 {
+			dtmKingSq[1] = append(dtmKingSq[1], sq)
+		}
+	}
+}
+
+func (t *DTMTable) kingSquares() []int {
+	if t.pawns {
+		return dtmKingSq[1]
+	}
+	return dtmKingSq[0]
+}
+
+func (t *DTMTable) size() int {
+	return len(t.kingSquares()) << (6*(len(t.pieces)-1) + 1)
+}
+
+// index returns the entry of a position, given by the squares of the
+// pieces in table order, under the symmetry that makes the squares
+// smallest.
+func (t *DTMTable) index(sq *[dtmMaxPieces]int, stm Color) int {
+	n := len(t.pieces)
+	symmetries := 8
+	if t.pawns {
+		symmetries = 2
+	}
+	best := -1
+	for s := 0; s < symmetries; s++ {
+		key := 0
+		for i := 0; i < n; i++ {
+			key = key<<6 | dtmSymmetry[s][sq[i]]
+		}
+		if best < 0 || key < best {
+			best = key
+		}
+	}
+	shift := 6 * (n - 1)
+	king := best >> shift
+	if t.pawns {
+		king = king/8*4 + king%8
+	} else {
+		king = dtmKingIndex[king]
+	}
+	return (king<<shift|best&(1<<shift-1))<<1 | int(stm)
+}
+
+// decode is the inverse of index for the entries index returns.
+func (t *DTMTable) decode(idx int, sq *[dtmMaxPieces]int) Color {
+	stm := Color(idx & 1)
+	idx >>= 1
+	for i := len(t.pieces) - 1; i > 0; i-- {
+		sq[i] = idx & 63
+		idx >>= 6
+	}
+	sq[0] = t.kingSquares()[idx]
+	return stm
+}
+
+// squaresOf returns the squares of the pieces of the table in a position
+// of its material; with flip the colors are swapped and the board
+// mirrored, so that White is the stronger side.
+func (t *DTMTable) squaresOf(pos *BitPosition, flip bool, sq *[dtmMaxPieces]int) Color {
+	stm := pos.turn
+	for i, pc := range t.pieces {
+		color, mirror := pc.color, 0
+		if flip {
+			color, mirror = opposite(color), 56
+		}
+		sq[i] = pos.pieces[color][pc.pt].lsb() ^ mirror
+	}
+	if flip {
+		stm = opposite(stm)
+	}
+	return stm
+}
+
+// position sets up the position of squares in table order.
+func (t *DTMTable) position(sq *[dtmMaxPieces]int, stm Color) *BitPosition {
+	p := &BitPosition{turn: stm, ep: noSquare}
+	for i := range p.squares {
+		p.squares[i] = noPiece
+	}
+	for i, pc := range t.pieces {
+		p.put(sq[i], pc.color, pc.pt)
+	}
+	return p
+}
+
+// lookup finds the table of the material of a position. flip tells
+// whether Black is the stronger side.
+func (e *Endgames) lookup(pos *BitPosition) (t *DTMTable, flip bool) {
+	if e == nil || pos.occupied.count() > dtmMaxPieces || pos.castling != 0 {
+		return nil, false
+	}
+	white, black := pos.material(White), pos.material(Black)
+	if t := e.tables[white+black]; t != nil {
+		return t, false
+	}
+	if t := e.tables[black+white]; t != nil {
+		return t, true
+	}
+	return nil, false
+}
+
+// value returns the entry of a position in the tables: plies to mate + 1,
+// or 0 for a draw. Positions without mating material are draws.
+func (e *Endgames) value(pos *BitPosition) (uint8, bool) {
+	if e == nil {
+		return 0, false
+	}
+	if isDeadMaterial(pos) {
+		return 0, true
+	}
+	t, flip := e.lookup(pos)
+	if t == nil {
+		return 0, false
+	}
+	var sq [dtmMaxPieces]int
+	stm := t.squaresOf(pos, flip, &sq)
+	return t.dtm[t.index(&sq, stm)], true
+}
+
+// isDeadMaterial tells whether only the kings and at most one minor piece
+// are left.
+func isDeadMaterial(pos *BitPosition) bool {
+	minors := pos.occupied.count() - 2
+	if minors == 0 {
+		return true
+	}
+	for c := White; c <= Black; c++ {
+		if pos.pieces[c][Bishop]|pos.pieces[c][Knight] != 0 {
+			return minors == 1
+		}
+	}
+	return false
+}
+
+// dtmResult converts an entry into the result for the side to move and
+// the plies to mate.
+func dtmResult(v uint8) (WDL, int) {
+	switch {
+	case v == 0:
+		return WDLDraw, 0
+	case v%2 == 0:
+		return WDLWin, int(v) - 1
+	}
+	return WDLLoss, int(v) - 1
+}
+
+// Probe returns the result of the current position of the game for the
+// side to move and the plies to mate. ok is false if there is no table
+// for the position.
+func (e *Endgames) Probe(game *Game) (wdl WDL, plies int, ok bool) {
+	v, ok := e.value(game.BitPosition())
+	if !ok {
+		return WDLDraw, 0, false
+	}
+	wdl, plies = dtmResult(v)
+	return wdl, plies, true
+}
+
+// score returns the search score of a position in the tables, ply plies
+// from the root.
+func (e *Endgames) score(pos *BitPosition, ply int) (int, bool) {
+	v, ok := e.value(pos)
+	if !ok {
+		return 0, false
+	}
+	switch wdl, plies := dtmResult(v); wdl {
+	case WDLWin:
+		return MateScore - ply - plies, true
+	case WDLLoss:
+		return -MateScore + ply + plies, true
+	}
+	return 0, true
+}
+
+// rootMoves returns the moves of the game that mate fastest, keep the
+// draw, or are mated slowest, and the score of the position.
+func (e *Endgames) rootMoves(game *Game) (moves []bitMove, score int, ok bool) {
+	if e == nil {
+		return nil, 0, false
+	}
+	pos := game.BitPosition()
+	if t, _ := e.lookup(pos); t == nil {
+		return nil, 0, false
+	}
+	score = -infinity
+	for _, m := range pos.legalMoves() {
+		child := *pos
+		child.makeMove(m)
+		s, ok := e.score(&child, 1)
+		if !ok {
+			return nil, 0, false
+		}
+		if -s > score {
+			moves, score = moves[:0], -s
+		}
+		if -s == score {
+			moves = append(moves, m)
+		}
+	}
+	return moves, score, moves != nil
+}
+
+// Generate builds the table of a material by retrograde analysis and adds
+// it to the set, together with the tables of the materials that captures
+// and promotions lead to.
+func (e *Endgames) Generate(material string) (*DTMTable, error) {
+	if t := e.tables[material]; t != nil {
+		return t, nil
+	}
+	t, err := newDTMTable(material)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.generateConversions(t); err != nil {
+		return nil, err
+	}
+	g := newDTMGenerator(e, t)
+	g.init()
+	g.solve()
+	e.tables[material] = t
+	return t, nil
+}
+
+// generateConversions generates the tables of the materials that are left
+// after a capture or a promotion.
+func (e *Endgames) generateConversions(t *DTMTable) error {
+	var counts [2][6]int
+	for _, pc := range t.pieces {
+		counts[pc.color][pc.pt]++
+	}
+	var materials []string
+	for _, pc := range t.pieces {
+		if pc.pt == King {
+			continue
+		}
+		c := counts
+		c[pc.color][pc.pt]--
+		materials = append(materials, materialName(c))
+		if pc.pt == Pawn {
+			for _, promo := range promotionTypes {
+				c := counts
+				c[pc.color][Pawn]--
+				c[pc.color][promo]++
+				materials = append(materials, materialName(c))
+			}
+		}
+	}
+	for _, m := range materials {
+		if m == "" {
+			continue // no mating material
+		}
+		if _, err := e.Generate(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// materialName names a material with the stronger side first, or returns
+// "" if neither side can mate.
+func materialName(counts [2][6]int) string {
+	var names [2]string
+	var value [2]int
+	pieces := 0
+	minors := 0
+	for c := range counts {
+		names[c] = "K"
+		for pt := Queen; pt <= Pawn; pt++ {
+			for i := 0; i < counts[c][pt]; i++ {
+				names[c] += string("KQRBNP"[pt])
+				value[c] += getPieceValue(pt)
+				pieces++
+				if pt == Bishop || pt == Knight {
+					minors++
+				}
+			}
+		}
+	}
+	if pieces == 0 || (pieces == 1 && minors == 1) {
+		return ""
+	}
+	if value[Black] > value[White] {
+		return names[Black] + names[White]
+	}
+	return names[White] + names[Black]
+}
+
+// dtmGenerator holds the state of the retrograde analysis of a table.
+type dtmGenerator struct {
+	e *Endgames
+	t *DTMTable
+
+	unused     []bool  // illegal positions and entries index never returns
+	counter    []uint8 // moves within the table that are not known to lose
+	cannotLose []bool  // a capture or promotion draws or wins
+	convLoss   []uint8 // plies to being mated after the slowest losing capture or promotion
+	plies      [][]int32
+}
+
+func newDTMGenerator(e *Endgames, t *DTMTable) *dtmGenerator {
+	n := len(t.dtm)
+	return &dtmGenerator{
+		e:          e,
+		t:          t,
+		unused:     make([]bool, n),
+		counter:    make([]uint8, n),
+		cannotLose: make([]bool, n),
+		convLoss:   make([]uint8, n),
+		plies:      make([][]int32, 256),
+	}
+}
+
+// init sets up all positions: it counts the moves that stay within the
+// table, solves the captures and promotions with the smaller tables and
+// finds the checkmates.
+func (g *dtmGenerator) init() {
+	t := g.t
+	var sq, childSq [dtmMaxPieces]int
+	moves := make([]bitMove, 0, 256)
+	var children []int
+	for idx := range t.dtm {
+		stm := t.decode(idx, &sq)
+		if !g.valid(&sq, stm) || t.index(&sq, stm) != idx {
+			g.unused[idx] = true
+			continue
+		}
+		pos := t.position(&sq, stm)
+		if pos.inCheck(opposite(stm)) {
+			g.unused[idx] = true
+			continue
+		}
+
+		legal := 0
+		convWin := 0
+		children = children[:0]
+		moves = pos.generateMoves(moves[:0])
+		for _, m := range moves {
+			child := *pos
+			child.makeMove(m)
+			if child.inCheck(stm) {
+				continue
+			}
+			legal++
+			if child.occupied.count() == len(t.pieces) && !isPromotion(m) {
+				t.squaresOf(&child, false, &childSq)
+				c := t.index(&childSq, child.turn)
+				if !containsInt(children, c) {
+					children = append(children, c)
+				}
+				continue
+			}
+			v, _ := g.e.value(&child)
+			switch wdl, plies := dtmResult(v); wdl {
+			case WDLDraw:
+				g.cannotLose[idx] = true
+			case WDLLoss:
+				g.cannotLose[idx] = true
+				if convWin == 0 || plies+1 < convWin {
+					convWin = plies + 1
+				}
+			case WDLWin:
+				if plies+1 > int(g.convLoss[idx]) {
+					g.convLoss[idx] = uint8(plies + 1)
+				}
+			}
+		}
+		g.counter[idx] = uint8(len(children))
+
+		switch {
+		case legal == 0 && pos.inCheck(stm):
+			g.plies[0] = append(g.plies[0], int32(idx))
+		case legal == 0:
+			// stalemate
+		case convWin > 0:
+			g.plies[convWin] = append(g.plies[convWin], int32(idx))
+		case len(children) == 0 && !g.cannotLose[idx]:
+			p := g.convLoss[idx]
+			g.plies[p] = append(g.plies[p], int32(idx))
+		}
+	}
+}
+
+func isPromotion(m bitMove) bool {
+	_, ok := m.promotion()
+	return ok
+}
+
+func containsInt(s []int, x int) bool {
+	for _, v := range s {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// valid tells whether the pieces stand on different squares, pawns not on
+// the first or last rank, and the kings apart.
+func (g *dtmGenerator) valid(sq *[dtmMaxPieces]int, stm Color) bool {
+	var occupied Bitboard
+	var kings [2]int
+	for i, pc := range g.t.pieces {
+		if occupied&squareBB(sq[i]) != 0 {
+			return false
+		}
+		occupied |= squareBB(sq[i])
+		switch pc.pt {
+		case Pawn:
+			if sq[i]/8 == 0 || sq[i]/8 == 7 {
+				return false
+			}
+		case King:
+			kings[pc.color] = sq[i]
+		}
+	}
+	return kingAttacks[kings[White]]&squareBB(kings[Black]) == 0
+}
+
+// solve solves the positions ply by ply. A position mated in n plies wins
+// in n+1 plies for all positions a move leads to it from. A position that
+// mates in n plies is one move less the position is lost from once all
+// other moves lose too.
+func (g *dtmGenerator) solve() {
+	t := g.t
+	var sq [dtmMaxPieces]int
+	var preds []int
+	for n := 0; n < len(g.plies); n++ {
+		for _, i := range g.plies[n] {
+			idx := int(i)
+			if t.dtm[idx] != 0 {
+				continue
+			}
+			t.dtm[idx] = uint8(n + 1)
+			if n+1 >= len(g.plies) {
+				continue
+			}
+			stm := t.decode(idx, &sq)
+			preds = g.predecessors(&sq, stm, preds[:0])
+			for _, q := range preds {
+				if g.unused[q] || t.dtm[q] != 0 {
+					continue
+				}
+				if n%2 == 0 {
+					g.plies[n+1] = append(g.plies[n+1], int32(q))
+					continue
+				}
+				g.counter[q]--
+				if g.counter[q] == 0 && !g.cannotLose[q] {
+					p := max(n+1, int(g.convLoss[q]))
+					g.plies[p] = append(g.plies[p], int32(q))
+				}
+			}
+		}
+		g.plies[n] = nil
+	}
+}
+
+// predecessors appends the entries of the positions a move within the
+// table leads to the position from, each once.
+func (g *dtmGenerator) predecessors(sq *[dtmMaxPieces]int, stm Color, preds []int) []int {
+	t := g.t
+	mover := opposite(stm)
+	var occupied Bitboard
+	for i := range t.pieces {
+		occupied |= squareBB(sq[i])
+	}
+	prev := *sq
+	for i, pc := range t.pieces {
+		if pc.color != mover {
+			continue
+		}
+		from := sq[i]
+		var origins Bitboard
+		switch pc.pt {
+		case King:
+			origins = kingAttacks[from]
+		case Queen:
+			origins = rookAttacks(from, occupied) | bishopAttacks(from, occupied)
+		case Rook:
+			origins = rookAttacks(from, occupied)
+		case Bishop:
+			origins = bishopAttacks(from, occupied)
+		case Knight:
+			origins = knightAttacks[from]
+		case Pawn:
+			// White pawns move towards row 0, black ones towards row 7.
+			back, doubleRow := 8, 4
+			if mover == Black {
+				back, doubleRow = -8, 3
+			}
+			one := from + back
+			if r := one / 8; r != 0 && r != 7 && occupied&squareBB(one) == 0 {
+				origins |= squareBB(one)
+				if from/8 == doubleRow {
+					origins |= squareBB(one + back)
+				}
+			}
+		}
+		for origins &^= occupied; origins != 0; {
+			prev[i] = origins.pop()
+			q := t.index(&prev, mover)
+			if !containsInt(preds, q) {
+				preds = append(preds, q)
+			}
+		}
+		prev[i] = from
+	}
+	return preds
+}
+
+// dtmVersion is the version of the file format written by WriteTo: the
+// magic "CDTM", the version, the length of the material name and the
+// name, the number of entries as a little-endian uint32 and the entries,
+// compressed with DEFLATE.
+const dtmVersion = 1
+
+// WriteTo writes the table to w.
+func (t *DTMTable) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	header := append(dtmMagic[:], dtmVersion, byte(len(t.material)))
+	header = append(header, t.material...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(t.dtm)))
+	if _, err := cw.Write(header); err != nil {
+		return cw.n, err
+	}
+	zw, err := flate.NewWriter(cw, flate.BestCompression)
+	if err != nil {
+		return cw.n, err
+	}
+	if _, err := zw.Write(t.dtm); err != nil {
+		return cw.n, err
+	}
+	err = zw.Close()
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ReadDTMTable reads a table written by WriteTo.
+func ReadDTMTable(r io.Reader) (*DTMTable, error) {
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if [4]byte(header[:4]) != dtmMagic || header[4] != dtmVersion {
+		return nil, fmt.Errorf("not a DTM table")
+	}
+	name := make([]byte, header[5])
+	var size uint32
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	t, err := newDTMTable(string(name))
+	if err != nil {
+		return nil, err
+	}
+	if int(size) != len(t.dtm) {
+		return nil, fmt.Errorf("%s: %d entries, want %d", name, size, len(t.dtm))
+	}
+	zr := flate.NewReader(r)
+	defer zr.Close()
+	if _, err := io.ReadFull(zr, t.dtm); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,88 @@
+package chess
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEndgamesProbe(t *testing.T) {
+	e := NewEndgames()
+	for _, m := range []string{"KQK", "KRK", "KPK"} {
+		if _, err := e.Generate(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		fen   string
+		wdl   WDL
+		plies int
+	}{
+		{"6k1/8/6K1/8/8/8/8/R7 w - - 0 1", WDLWin, 1},   // Ra8#
+		{"6k1/8/6K1/8/8/8/8/R7 b - - 0 1", WDLLoss, 4},  // Kf8
+		{"R5k1/8/6K1/8/8/8/8/8 b - - 0 1", WDLLoss, 0},  // mated
+		{"8/8/8/8/8/8/8/K5kQ b - - 0 1", WDLDraw, 0},    // Kxh1
+		{"8/8/8/8/8/8/8/k5Kq w - - 0 1", WDLDraw, 0},    // colors swapped
+		{"1k6/1P6/1K6/8/8/8/8/8 b - - 0 1", WDLDraw, 0}, // stalemate
+		{"8/8/8/4k3/8/8/4P3/4K3 w - - 0 1", WDLDraw, 0},
+		{"8/8/8/3k4/8/8/8/K7 w - - 0 1", WDLDraw, 0}, // bare kings
+	}
+	for _, tc := range tests {
+		game, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wdl, plies, ok := e.Probe(game)
+		if !ok || wdl != tc.wdl || plies != tc.plies {
+			t.Errorf("%s: got %d in %d plies (%v), want %d in %d", tc.fen, wdl, plies, ok, tc.wdl, tc.plies)
+		}
+	}
+
+	// The longest mates of KQK and KRK take 10 and 16 moves.
+	longest := map[string]int{"KQK": 20, "KRK": 32}
+	for m, want := range longest {
+		got := 0
+		for _, v := range e.tables[m].dtm {
+			got = max(got, int(v)-1)
+		}
+		if got != want {
+			t.Errorf("%s: longest loss in %d plies, want %d", m, got, want)
+		}
+	}
+}
+
+func TestDTMTableReadWrite(t *testing.T) {
+	table, err := NewEndgames().Generate("KRK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := table.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadDTMTable(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Material() != "KRK" || !bytes.Equal(read.dtm, table.dtm) {
+		t.Error("table changed by writing and reading it")
+	}
+}
+
+func TestEndgamesSearch(t *testing.T) {
+	e := NewEndgames()
+	if _, err := e.Generate("KQK"); err != nil {
+		t.Fatal(err)
+	}
+	SetEndgames(e)
+	defer SetEndgames(nil)
+
+	// A search of depth 1 finds the mate in 2 moves: Kc6 and Qb7#.
+	game, err := ParseFEN("k7/8/8/2K5/8/8/8/1Q6 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := SearchDepth(game, 1)
+	if mateIn(r.Score) != 2 {
+		t.Errorf("got score %d, want mate in 2", r.Score)
+	}
+}
@@ -0,0 +1,281 @@
+package chess
+
+// EvalFunc evaluates a position in centipawns from the point of view of the
+// side to move.
+type EvalFunc func(pos *BitPosition) int
+
+var evaluation EvalFunc = Evaluate
+
+// SetEvaluation replaces the evaluation used by the search, e.g. to compare
+// variants. nil restores Evaluate. It waits for running searches to end.
+func SetEvaluation(f EvalFunc) {
+	if f == nil {
+		f = Evaluate
+	}
+	settings.Lock()
+	defer settings.Unlock()
+	evaluation = f
+}
+
+// Pieces returns the squares of the pieces of a color and type.
+func (p *BitPosition) Pieces(color Color, pt PieceType) Bitboard {
+	return p.pieces[color][pt]
+}
+
+// EvaluateMaterial counts material only.
+func EvaluateMaterial(pos *BitPosition) int {
+	var score int
+	for pt := King; pt <= Pawn; pt++ {
+		n := pos.pieces[pos.turn][pt].count() - pos.pieces[opposite(pos.turn)][pt].count()
+		score += n * getPieceValue(pt)
+	}
+	return score
+}
+
+// Piece-square tables from White's point of view, a8 first. Black uses the
+// square mirrored vertically. Only the king has a separate endgame table;
+// it belongs in the centre once the queens are gone.
+var (
+	pstMiddlegame = [6][64]int{
+		King: {
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-20, -30, -30, -40, -40, -30, -30, -20,
+			-10, -20, -20, -20, -20, -20, -20, -10,
+			20, 20, 0, 0, 0, 0, 20, 20,
+			20, 30, 10, 0, 0, 10, 30, 20,
+		},
+		Queen: {
+			-20, -10, -10, -5, -5, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-5, 0, 5, 5, 5, 5, 0, -5,
+			0, 0, 5, 5, 5, 5, 0, -5,
+			-10, 5, 5, 5, 5, 5, 0, -10,
+			-10, 0, 5, 0, 0, 0, 0, -10,
+			-20, -10, -10, -5, -5, -10, -10, -20,
+		},
+		Rook: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			5, 10, 10, 10, 10, 10, 10, 5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			0, 0, 0, 5, 5, 0, 0, 0,
+		},
+		Bishop: {
+			-20, -10, -10, -10, -10, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 5, 5, 10, 10, 5, 5, -10,
+			-10, 0, 10, 10, 10, 10, 0, -10,
+			-10, 10, 10, 10, 10, 10, 10, -10,
+			-10, 5, 0, 0, 0, 0, 5, -10,
+			-20, -10, -10, -10, -10, -10, -10, -20,
+		},
+		Knight: {
+			-50, -40, -30, -30, -30, -30, -40, -50,
+			-40, -20, 0, 0, 0, 0, -20, -40,
+			-30, 0, 10, 15, 15, 10, 0, -30,
+			-30, 5, 15, 20, 20, 15, 5, -30,
+			-30, 0, 15, 20, 20, 15, 0, -30,
+			-30, 5, 10, 15, 15, 10, 5, -30,
+			-40, -20, 0, 5, 5, 0, -20, -40,
+			-50, -40, -30, -30, -30, -30, -40, -50,
+		},
+		Pawn: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			10, 10, 20, 30, 30, 20, 10, 10,
+			5, 5, 10, 25, 25, 10, 5, 5,
+			0, 0, 0, 20, 20, 0, 0, 0,
+			5, -5, -10, 0, 0, -10, -5, 5,
+			5, 10, 10, -20, -20, 10, 10, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+	}
+	pstEndgame = [6][64]int{
+		King: {
+			-50, -40, -30, -20, -20, -30, -40, -50,
+			-30, -20, -10, 0, 0, -10, -20, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -30, 0, 0, 0, 0, -30, -30,
+			-50, -30, -30, -30, -30, -30, -30, -50,
+		},
+		Queen:  pstMiddlegame[Queen],
+		Rook:   pstMiddlegame[Rook],
+		Bishop: pstMiddlegame[Bishop],
+		Knight: pstMiddlegame[Knight],
+		Pawn:   pstMiddlegame[Pawn],
+	}
+)
+
+// Evaluation weights as middlegame and endgame values.
+var (
+	mobilityWeight = [6][2]int{Queen: {1, 2}, Rook: {2, 4}, Bishop: {5, 5}, Knight: {4, 4}}
+	doubledPawn    = [2]int{-10, -20}
+	isolatedPawn   = [2]int{-10, -15}
+	passedPawn     = [8][2]int{{0, 0}, {5, 10}, {10, 20}, {15, 35}, {25, 60}, {40, 100}, {60, 150}, {0, 0}} // by ranks advanced
+	bishopPair     = [2]int{30, 50}
+	pawnShield     = 10 // per pawn in front of the king, middlegame only
+	kingZoneAttack = 8  // per attack on a square next to the king, middlegame only
+)
+
+// Game phase weights of the pieces; the sum is 24 in the initial position
+// and 0 in a pawn endgame.
+var phaseWeight = [6]int{Queen: 4, Rook: 2, Bishop: 1, Knight: 1}
+
+const maxPhase = 24
+
+var (
+	fileBB         [8]Bitboard
+	adjacentFiles  [8]Bitboard
+	passedPawnMask [2][64]Bitboard // squares in front on the same and adjacent files
+	shieldMask     [2][64]Bitboard // the two ranks in front of the king
+)
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		fileBB[sq%8] |= squareBB(sq)
+	}
+	for f := 0; f < 8; f++ {
+		if f > 0 {
+			adjacentFiles[f] |= fileBB[f-1]
+		}
+		if f < 7 {
+			adjacentFiles[f] |= fileBB[f+1]
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		row, files := sq/8, fileBB[sq%8]|adjacentFiles[sq%8]
+		for r := 0; r < 8; r++ {
+			rank := Bitboard(0xFF) << uint(8*r)
+			if r < row {
+				passedPawnMask[White][sq] |= files & rank
+			} else if r > row {
+				passedPawnMask[Black][sq] |= files & rank
+			}
+			if r == row-1 || r == row-2 {
+				shieldMask[White][sq] |= files & rank
+			} else if r == row+1 || r == row+2 {
+				shieldMask[Black][sq] |= files & rank
+			}
+		}
+	}
+}
+
+// Evaluate is the default evaluation: material, piece-square tables,
+// mobility, pawn structure, king safety and the bishop pair, blended
+// between middlegame and endgame weights by the material left on the board.
+func Evaluate(pos *BitPosition) int {
+	var mg, eg, phase int
+	for _, color := range []Color{White, Black} {
+		sign := 1
+		if color == Black {
+			sign = -1
+		}
+		m, e, ph := evaluateSide(pos, color)
+		mg += sign * m
+		eg += sign * e
+		phase += ph
+	}
+	if phase > maxPhase {
+		phase = maxPhase
+	}
+	score := (mg*phase + eg*(maxPhase-phase)) / maxPhase
+	if pos.turn == Black {
+		return -score
+	}
+	return score
+}
+
+// evaluateSide returns the middlegame and endgame score of one side and its
+// contribution to the game phase.
+func evaluateSide(pos *BitPosition, us Color) (mg, eg, phase int) {
+	them := opposite(us)
+	pcs := &pos.pieces[us]
+	own := pos.colors[us]
+	var enemyKingZone Bitboard
+	if k := pos.pieces[them][King]; k != 0 {
+		enemyKingZone = kingAttacks[k.lsb()]
+	}
+
+	for pt := King; pt <= Pawn; pt++ {
+		for bb := pcs[pt]; bb != 0; {
+			sq := bb.pop()
+			psq := sq
+			if us == Black {
+				psq ^= 56
+			}
+			value := getPieceValue(pt)
+			mg += value + pstMiddlegame[pt][psq]
+			eg += value + pstEndgame[pt][psq]
+			phase += phaseWeight[pt]
+
+			var attacks Bitboard
+			switch pt {
+			case Knight:
+				attacks = knightAttacks[sq]
+			case Bishop:
+				attacks = bishopAttacks(sq, pos.occupied)
+			case Rook:
+				attacks = rookAttacks(sq, pos.occupied)
+			case Queen:
+				attacks = bishopAttacks(sq, pos.occupied) | rookAttacks(sq, pos.occupied)
+			default:
+				continue
+			}
+			mobility := (attacks &^ own).count()
+			mg += mobility*mobilityWeight[pt][0] + kingZoneAttack*(attacks&enemyKingZone).count()
+			eg += mobility * mobilityWeight[pt][1]
+		}
+	}
+
+	if pcs[Bishop].count() >= 2 {
+		mg += bishopPair[0]
+		eg += bishopPair[1]
+	}
+
+	// Pawn structure.
+	enemyPawns := pos.pieces[them][Pawn]
+	for f := 0; f < 8; f++ {
+		n := (pcs[Pawn] & fileBB[f]).count()
+		if n == 0 {
+			continue
+		}
+		if n > 1 {
+			mg += (n - 1) * doubledPawn[0]
+			eg += (n - 1) * doubledPawn[1]
+		}
+		if pcs[Pawn]&adjacentFiles[f] == 0 {
+			mg += n * isolatedPawn[0]
+			eg += n * isolatedPawn[1]
+		}
+	}
+	for bb := pcs[Pawn]; bb != 0; {
+		sq := bb.pop()
+		if passedPawnMask[us][sq]&enemyPawns != 0 {
+			continue
+		}
+		advanced := 6 - sq/8
+		if us == Black {
+			advanced = sq/8 - 1
+		}
+		mg += passedPawn[advanced][0]
+		eg += passedPawn[advanced][1]
+	}
+
+	// King safety: a pawn shield only counts while there are pieces to
+	// attack the king, which the tapering takes care of.
+	if k := pcs[King]; k != 0 {
+		mg += pawnShield * (shieldMask[us][k.lsb()] & pcs[Pawn]).count()
+	}
+	return mg, eg, phase
+}
@@ -0,0 +1,243 @@
+package chess
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// StartFEN is the FEN string of the standard starting position.
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// fenLetters holds the FEN letter of each piece type, indexed by PieceType.
+const fenLetters = "kqrbnp"
+
+// ParseFEN sets up a game from a position in Forsyth-Edwards Notation.
+// Castling rights are mapped onto the hasMoved flag of kings and rooks.
+func ParseFEN(fen string) (*Game, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid FEN %q: expected 6 fields, got %d", fen, len(fields))
+	}
+
+	board, err := ParseBoardFEN(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var turn Color
+	switch fields[1] {
+	case "w":
+		turn = White
+	case "b":
+		turn = Black
+	default:
+		return nil, fmt.Errorf("invalid FEN side to move %q", fields[1])
+	}
+
+	if err := applyCastlingRights(board, fields[2]); err != nil {
+		return nil, err
+	}
+
+	var ep *Position
+	if fields[3] != "-" {
+		p, err := ParsePosition(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid FEN en passant square: %w", err)
+		}
+		if (turn == White && p.Row != 2) || (turn == Black && p.Row != 5) {
+			return nil, fmt.Errorf("invalid FEN en passant square %q", fields[3])
+		}
+		ep = &p
+	}
+
+	halfmove, err := strconv.Atoi(fields[4])
+	if err != nil || halfmove < 0 {
+		return nil, fmt.Errorf("invalid FEN halfmove clock %q", fields[4])
+	}
+	fullmove, err := strconv.Atoi(fields[5])
+	if err != nil || fullmove < 1 {
+		return nil, fmt.Errorf("invalid FEN fullmove number %q", fields[5])
+	}
+
+	g := &Game{
+		board:          board,
+		turn:           turn,
+		cursor:         &Position{Row: 0, Col: 0},
+		moveLog:        NewMoveLog(),
+		boardHistory:   []*Board{board.Clone()},
+		enPassant:      ep,
+		halfmoveClock:  halfmove,
+		fullmoveNumber: fullmove,
+	}
+	g.rehash()
+	if start := g.FEN(); start != StartFEN {
+		g.startFEN = start
+	}
+	return g, nil
+}
+
+// ParseBoardFEN parses the piece placement field of a FEN string. Each
+// side needs exactly one king, and pawns cannot stand on the first or the
+// eighth rank.
+func ParseBoardFEN(placement string) (*Board, error) {
+	board := &Board{}
+	var kings [2]int
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf("invalid FEN placement %q: expected 8 ranks", placement)
+	}
+	for r, rank := range ranks {
+		c := 0
+		for _, ch := range rank {
+			if ch >= '1' && ch <= '8' {
+				c += int(ch - '0')
+				continue
+			}
+			i := strings.IndexRune(fenLetters, unicode.ToLower(ch))
+			if i < 0 || c > 7 {
+				return nil, fmt.Errorf("invalid FEN placement %q", placement)
+			}
+			color := Black
+			if unicode.IsUpper(ch) {
+				color = White
+			}
+			pt := PieceType(i)
+			if pt == Pawn && (r == 0 || r == 7) {
+				return nil, fmt.Errorf("invalid FEN placement %q: pawn on rank %d", placement, 8-r)
+			}
+			if pt == King {
+				kings[color]++
+			}
+			piece := NewPiece(pt, color)
+			if pt == Pawn {
+				piece.hasMoved = (color == White && r != 6) || (color == Black && r != 1)
+			}
+			board[r][c] = piece
+			c++
+		}
+		if c != 8 {
+			return nil, fmt.Errorf("invalid FEN placement %q: rank %d has %d squares", placement, 8-r, c)
+		}
+	}
+	if kings[White] != 1 || kings[Black] != 1 {
+		return nil, fmt.Errorf("invalid FEN placement %q: each side needs one king", placement)
+	}
+	return board, nil
+}
+
+// applyCastlingRights marks kings and rooks as moved unless the castling
+// rights allow them to castle.
+func applyCastlingRights(board *Board, rights string) error {
+	if rights == "" {
+		return fmt.Errorf("invalid FEN castling rights %q", rights)
+	}
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			if p := board[r][c]; p != nil && (p.pieceType == King || p.pieceType == Rook) {
+				p.hasMoved = true
+			}
+		}
+	}
+	if rights == "-" {
+		return nil
+	}
+	for _, ch := range rights {
+		row, rookCol := 7, 7
+		color := White
+		switch ch {
+		case 'K':
+		case 'Q':
+			rookCol = 0
+		case 'k':
+			row, color = 0, Black
+		case 'q':
+			row, rookCol, color = 0, 0, Black
+		default:
+			return fmt.Errorf("invalid FEN castling rights %q", rights)
+		}
+		king, rook := board[row][4], board[row][rookCol]
+		if king == nil || king.pieceType != King || king.color != color ||
+			rook == nil || rook.pieceType != Rook || rook.color != color {
+			return fmt.Errorf("invalid FEN castling rights %q: no king and rook for %c", rights, ch)
+		}
+		king.hasMoved = false
+		rook.hasMoved = false
+	}
+	return nil
+}
+
+// FEN returns the piece placement field of the board in Forsyth-Edwards
+// Notation.
+func (b *Board) FEN() string {
+	var sb strings.Builder
+	for r := 0; r < 8; r++ {
+		empty := 0
+		for c := 0; c < 8; c++ {
+			p := b[r][c]
+			if p == nil {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteRune(p.fenRune())
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if r < 7 {
+			sb.WriteByte('/')
+		}
+	}
+	return sb.String()
+}
+
+// FEN returns the current position of the game in Forsyth-Edwards Notation.
+func (g *Game) FEN() string {
+	turn := "w"
+	if g.turn == Black {
+		turn = "b"
+	}
+	ep := "-"
+	if p := g.EnPassantTarget(); p != nil {
+		ep = p.String()
+	}
+	return fmt.Sprintf("%s %s %s %s %d %d", g.board.FEN(), turn, castlingRights(g.board), ep, g.HalfmoveClock(), g.FullmoveNumber())
+}
+
+func castlingRights(board *Board) string {
+	canCastle := func(row, rookCol int, color Color) bool {
+		king, rook := board[row][4], board[row][rookCol]
+		return king != nil && king.pieceType == King && king.color == color && !king.hasMoved &&
+			rook != nil && rook.pieceType == Rook && rook.color == color && !rook.hasMoved
+	}
+	var sb strings.Builder
+	if canCastle(7, 7, White) {
+		sb.WriteByte('K')
+	}
+	if canCastle(7, 0, White) {
+		sb.WriteByte('Q')
+	}
+	if canCastle(0, 7, Black) {
+		sb.WriteByte('k')
+	}
+	if canCastle(0, 0, Black) {
+		sb.WriteByte('q')
+	}
+	if sb.Len() == 0 {
+		return "-"
+	}
+	return sb.String()
+}
+
+func (p *Piece) fenRune() rune {
+	r := rune(fenLetters[p.pieceType])
+	if p.color == White {
+		return unicode.ToUpper(r)
+	}
+	return r
+}
@@ -0,0 +1,20 @@
+package chess
+
+import "testing"
+
+func TestParseFENInvalidPositions(t *testing.T) {
+	for _, fen := range []string{
+		"P7/8/8/8/8/8/8/4K2k w - - 0 1",  // white pawn on the 8th rank
+		"4k3/8/8/8/8/8/8/4K2P w - - 0 1", // white pawn on the 1st rank
+		"4k2p/8/8/8/8/8/8/4K3 b - - 0 1", // black pawn on the 8th rank
+		"8/8/8/8/8/8/8/4K3 w - - 0 1",    // no black king
+		"4k3/8/8/8/8/8/8/8 b - - 0 1",    // no white king
+		"4k3/8/8/8/8/8/8/K3K3 w - - 0 1", // two white kings
+		"8/8/8/8/8/8/8/8 w - - 0 1",      // empty board
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNP w - - 0 1",
+	} {
+		if _, err := ParseFEN(fen); err == nil {
+			t.Errorf("%s: no error", fen)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package chess
 
+import "fmt"
+
 // Game represents the state of the chess game
 type Game struct {
 	board        *Board
@@ -10,6 +12,17 @@ type Game struct {
 	boardHistory []*Board
 	status       string
 	vsAI         bool
+
+	enPassant      *Position
+	halfmoveClock  int
+	fullmoveNumber int
+	undos          []undo
+	outcome        Outcome // set when the game ends by resignation, timeout, agreement or claim
+	startFEN       string  // position the game started from, empty for the standard one
+
+	// Zobrist hash of the current position, kept up to date by every
+	// change of the position.
+	hash uint64
 }
 
 func (g *Game) VsAI() bool {
@@ -26,6 +39,7 @@ func (g *Game) Board() *Board {
 
 func (g *Game) SetBoard(b *Board) {
 	g.board = b
+	g.rehash()
 }
 
 func (g *Game) Turn() Color {
@@ -34,6 +48,7 @@ func (g *Game) Turn() Color {
 
 func (g *Game) SetTurn(c Color) {
 	g.turn = c
+	g.rehash()
 }
 
 func (g *Game) Selected() *Position {
@@ -68,20 +83,71 @@ func (g *Game) SetStatus(s string) {
 	g.status = s
 }
 
+// EnPassantTarget returns the square behind a pawn that has just made a
+// double step, or nil if the last move was no double pawn push.
+func (g *Game) EnPassantTarget() *Position {
+	return g.enPassant
+}
+
+// HalfmoveClock returns the number of plies since the last capture or pawn
+// move.
+func (g *Game) HalfmoveClock() int {
+	return g.halfmoveClock
+}
+
+// FullmoveNumber returns the number of the current full move. It starts at
+// 1 and is incremented after each move of Black.
+func (g *Game) FullmoveNumber() int {
+	return g.fullmoveNumber
+}
+
+// clone returns a deep copy of the game state relevant for the rules.
+func (g *Game) clone() *Game {
+	c := *g
+	c.board = g.board.Clone()
+	c.cursor = &Position{Row: g.cursor.Row, Col: g.cursor.Col}
+	c.selected = nil
+	c.moveLog = &MoveLog{moves: append([]*Move(nil), g.moveLog.moves...)}
+	c.boardHistory = append([]*Board(nil), g.boardHistory...)
+	c.undos = append([]undo(nil), g.undos...)
+	for i := range c.undos {
+		if p := c.undos[i].captured; p != nil {
+			c.undos[i].captured = &Piece{pieceType: p.pieceType, color: p.color, hasMoved: p.hasMoved}
+		}
+	}
+	return &c
+}
+
 // Position represents a position on the board
 type Position struct {
 	Row int
 	Col int
 }
 
+// String returns the square in algebraic notation, e.g. "e4".
+func (p Position) String() string {
+	return fmt.Sprintf("%c%d", 'a'+p.Col, 8-p.Row)
+}
+
+// ParsePosition parses a square in algebraic notation, e.g. "e4".
+func ParsePosition(s string) (Position, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return Position{}, fmt.Errorf("invalid square %q", s)
+	}
+	return Position{Row: 8 - int(s[1]-'0'), Col: int(s[0] - 'a')}, nil
+}
+
 // NewGame creates a new game
 func NewGame() *Game {
-	return &Game{
-		board:        NewBoard(),
-		turn:         White,
-		cursor:       &Position{Row: 0, Col: 0},
-		moveLog:      NewMoveLog(),
-		boardHistory: []*Board{NewBoard()},
-		vsAI:         false,
+	g := &Game{
+		board:          NewBoard(),
+		turn:           White,
+		cursor:         &Position{Row: 0, Col: 0},
+		moveLog:        NewMoveLog(),
+		boardHistory:   []*Board{NewBoard()},
+		vsAI:           false,
+		fullmoveNumber: 1,
 	}
+	g.rehash()
+	return g
 }
@@ -0,0 +1,135 @@
+package chess
+
+import "fmt"
+
+// undo holds what is needed to take back a move.
+type undo struct {
+	move         Move
+	captured     *Piece
+	capturedAt   Position
+	hadMoved     bool // of the moved piece
+	rookHadMoved bool // of the rook of a castling
+	enPassant    *Position
+	halfmove     int
+	hash         uint64
+}
+
+// MakeMove plays a move on the game, including castling, en passant and
+// promotion, records it in the move log and passes the turn. The move has
+// to be legal in the current position, and the game must not have been
+// ended by resignation, timeout, agreement or a draw claim.
+func (g *Game) MakeMove(m Move) error {
+	if g.outcome.Result != Ongoing {
+		return fmt.Errorf("game is over")
+	}
+	var promotion *PieceType
+	if m.isPromotion {
+		promotion = &m.promotion
+	}
+	legal, ok := g.LegalMove(m.from, m.to, promotion)
+	if !ok {
+		return fmt.Errorf("illegal move %s", m.UCI())
+	}
+	g.play(legal)
+	return nil
+}
+
+// UnmakeMove takes back the last move played with MakeMove and restores the
+// position including castling rights, en passant target, halfmove clock
+// and hash. A game ended by resignation, timeout, agreement or a draw claim
+// is resumed.
+func (g *Game) UnmakeMove() error {
+	if len(g.undos) == 0 || len(g.moveLog.moves) == 0 {
+		return fmt.Errorf("no move to take back")
+	}
+	g.undoMove()
+	g.outcome = Outcome{}
+	g.moveLog.moves = g.moveLog.moves[:len(g.moveLog.moves)-1]
+	if len(g.boardHistory) > 1 {
+		g.boardHistory = g.boardHistory[:len(g.boardHistory)-1]
+	}
+	return nil
+}
+
+// play records a legal move in the move log and plays it on the board.
+func (g *Game) play(m Move) {
+	g.LogMove(m)
+	g.doMove(m)
+	g.boardHistory = append(g.boardHistory, g.board.Clone())
+}
+
+// doMove plays a move on the board and updates the game state without
+// checking its legality or logging it. It can be taken back with undoMove.
+func (g *Game) doMove(m Move) {
+	board := g.board
+	from, to := m.from, m.to
+	piece := board[from.Row][from.Col]
+
+	u := undo{move: m, hadMoved: piece.hasMoved, enPassant: g.enPassant, halfmove: g.halfmoveClock, hash: g.hash}
+	if captured := board[to.Row][to.Col]; captured != nil {
+		u.captured, u.capturedAt = captured, to
+	} else if piece.pieceType == Pawn && from.Col != to.Col {
+		u.captured, u.capturedAt = board[from.Row][to.Col], Position{Row: from.Row, Col: to.Col}
+	}
+	if rookFrom, _, ok := castlingRookMove(piece, m); ok {
+		u.rookHadMoved = board[rookFrom.Row][rookFrom.Col].hasMoved
+	}
+	h := u.hash ^ moveHashDelta(board, m) ^ castlingKey(castlingMask(board)) ^ epKey(board, g.enPassant, g.turn)
+
+	applyMove(board, m)
+
+	g.enPassant = enPassantSquareAfter(m)
+	if piece.pieceType == Pawn || u.captured != nil {
+		g.halfmoveClock = 0
+	} else {
+		g.halfmoveClock++
+	}
+	if g.turn == Black {
+		g.fullmoveNumber++
+	}
+	g.turn = opposite(g.turn)
+	g.hash = h ^ castlingKey(castlingMask(board)) ^ epKey(board, g.enPassant, g.turn)
+	g.undos = append(g.undos, u)
+}
+
+// undoMove takes back the last move played with doMove.
+func (g *Game) undoMove() {
+	u := g.undos[len(g.undos)-1]
+	g.undos = g.undos[:len(g.undos)-1]
+	board := g.board
+	m := u.move
+
+	g.turn = opposite(g.turn)
+	if g.turn == Black {
+		g.fullmoveNumber--
+	}
+	piece := board[m.to.Row][m.to.Col]
+	board.MovePiece(m.to, m.from)
+	piece.hasMoved = u.hadMoved
+	if m.isPromotion {
+		piece.pieceType = Pawn
+	}
+	if u.captured != nil {
+		board[u.capturedAt.Row][u.capturedAt.Col] = u.captured
+	}
+	if rookFrom, rookTo, ok := castlingRookMove(piece, m); ok {
+		board.MovePiece(rookTo, rookFrom)
+		board[rookFrom.Row][rookFrom.Col].hasMoved = u.rookHadMoved
+	}
+
+	g.enPassant = u.enPassant
+	g.halfmoveClock = u.halfmove
+	g.hash = u.hash
+}
+
+// castlingRookMove returns the squares the rook moves between if the king
+// castles with the move.
+func castlingRookMove(piece *Piece, m Move) (from, to Position, ok bool) {
+	if piece.pieceType != King || Abs(m.to.Col-m.from.Col) != 2 {
+		return Position{}, Position{}, false
+	}
+	if m.to.Col > m.from.Col {
+		return Position{Row: m.from.Row, Col: 7}, Position{Row: m.from.Row, Col: m.to.Col - 1}, true
+	}
+	return Position{Row: m.from.Row, Col: 0}, Position{Row: m.from.Row, Col: m.to.Col + 1}, true
+}
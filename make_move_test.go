@@ -0,0 +1,67 @@
+package chess
+
+import "testing"
+
+// checkPosition compares a game with the one set up from its FEN.
+func checkPosition(t *testing.T, g *Game, after string) {
+	t.Helper()
+	fen := g.FEN()
+	fresh, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatalf("after %s: %v", after, err)
+	}
+	if got := fresh.FEN(); got != fen {
+		t.Errorf("after %s: FEN %s reads back as %s", after, fen, got)
+	}
+	if g.Hash() != fresh.Hash() {
+		t.Errorf("after %s: hash %016x, want %016x of %s", after, g.Hash(), fresh.Hash(), fen)
+	}
+	if got, want := g.BitPosition().castling, fresh.BitPosition().castling; got != want {
+		t.Errorf("after %s: castling rights %04b, want %04b of %s", after, got, want, fen)
+	}
+	if got := g.BitPosition().Hash(); got != g.Hash() {
+		t.Errorf("after %s: hash %016x of the game, %016x of its position", after, g.Hash(), got)
+	}
+}
+
+func TestMakeUnmakeMove(t *testing.T) {
+	g, err := ParseFEN("r2nk2r/1P6/8/8/4p3/8/3P4/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPosition(t, g, "the start")
+	line := []struct{ uci, fen string }{
+		{"d2d4", "r2nk2r/1P6/8/8/3Pp3/8/8/R3K2R b KQkq d3 0 1"},
+		{"e4d3", "r2nk2r/1P6/8/8/8/3p4/8/R3K2R w KQkq - 0 2"}, // en passant
+		{"b7a8q", "Q2nk2r/8/8/8/8/3p4/8/R3K2R b KQk - 0 2"},   // promotion capturing a rook
+		{"e8g8", "Q2n1rk1/8/8/8/8/3p4/8/R3K2R w KQ - 1 3"},    // short castling
+		{"e1c1", "Q2n1rk1/8/8/8/8/3p4/8/2KR3R b - - 2 3"},     // long castling
+	}
+	var fens []string
+	for _, step := range line {
+		fens = append(fens, g.FEN())
+		m, err := ParseUCIMove(g, step.uci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.MakeMove(m); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.FEN(); got != step.fen {
+			t.Errorf("after %s: got %s, want %s", step.uci, got, step.fen)
+		}
+		checkPosition(t, g, step.uci)
+	}
+	for i := len(line) - 1; i >= 0; i-- {
+		if err := g.UnmakeMove(); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.FEN(); got != fens[i] {
+			t.Errorf("undoing %s: got %s, want %s", line[i].uci, got, fens[i])
+		}
+		checkPosition(t, g, "undoing "+line[i].uci)
+	}
+	if err := g.UnmakeMove(); err == nil {
+		t.Error("took back a move before the start")
+	}
+}
@@ -3,6 +3,7 @@ package chess
 import (
 	"fmt"
 	"strings"
+	"unicode"
 )
 
 // Move represents a single move in the game
@@ -13,12 +14,28 @@ type Move struct {
 	notation    string
 	isCapture   bool
 	checkStatus string
+	promotion   PieceType
+	isPromotion bool
 }
 
 func (m *Move) Notation() string {
 	return m.notation
 }
 
+func (m *Move) Piece() Piece {
+	return m.piece
+}
+
+func (m *Move) IsCapture() bool {
+	return m.isCapture
+}
+
+// Promotion returns the piece type a pawn is promoted to and whether the
+// move is a promotion at all.
+func (m *Move) Promotion() (PieceType, bool) {
+	return m.promotion, m.isPromotion
+}
+
 // MoveLog stores the history of moves in the game
 type MoveLog struct {
 	moves []*Move
@@ -35,17 +52,19 @@ func NewMoveLog() *MoveLog {
 	}
 }
 
-// AddMove adds a move to the log
-func (ml *MoveLog) AddMove(from, to Position, piece Piece, isCapture bool, checkStatus string) {
-	move := &Move{
-		from:        from,
-		to:          to,
-		piece:       piece,
-		isCapture:   isCapture,
-		checkStatus: checkStatus,
+// AddMove adds a legal move of the position before it to the log, in
+// Standard Algebraic Notation.
+func (ml *MoveLog) AddMove(pos *BitPosition, m Move) {
+	m.notation = pos.san(toBitMove(m), nil)
+	switch {
+	case strings.HasSuffix(m.notation, "#"):
+		m.checkStatus = "#"
+	case strings.HasSuffix(m.notation, "+"):
+		m.checkStatus = "+"
+	default:
+		m.checkStatus = ""
 	}
-	move.notation = moveToAlgebraic(move)
-	ml.moves = append(ml.moves, move)
+	ml.moves = append(ml.moves, &m)
 }
 
 func (ml *MoveLog) LastMove() *Move {
@@ -55,57 +74,6 @@ func (ml *MoveLog) LastMove() *Move {
 	return ml.moves[len(ml.moves)-1]
 }
 
-func moveToAlgebraic(move *Move) string {
-	// Handle castling first
-	if move.piece.Type() == King {
-		dx := move.to.Col - move.from.Col
-		if dx == 2 {
-			return "O-O" + move.checkStatus
-		}
-		if dx == -2 {
-			return "O-O-O" + move.checkStatus
-		}
-	}
-
-	var sb strings.Builder
-
-	switch move.piece.Type() {
-	case King:
-		sb.WriteString("K")
-	case Queen:
-		sb.WriteString("Q")
-	case Rook:
-		sb.WriteString("R")
-	case Bishop:
-		sb.WriteString("B")
-	case Knight:
-		sb.WriteString("N")
-	}
-
-	sb.WriteString(fmt.Sprintf("%c%d", 'a'+move.from.Col, 8-move.from.Row))
-	if move.isCapture {
-		sb.WriteString("x")
-	} else {
-		sb.WriteString("-")
-	}
-	sb.WriteString(fmt.Sprintf("%c%d", 'a'+move.to.Col, 8-move.to.Row))
-	sb.WriteString(move.checkStatus)
-
-	return sb.String()
-}
-
-func NewMove(from, to Position, piece Piece, isCapture bool, checkStatus string) *Move {
-	move := &Move{
-		from:        from,
-		to:          to,
-		piece:       piece,
-		isCapture:   isCapture,
-		checkStatus: checkStatus,
-	}
-	move.notation = moveToAlgebraic(move)
-	return move
-}
-
 func (m *Move) From() Position {
 	return m.from
 }
@@ -114,6 +82,46 @@ func (m *Move) To() Position {
 	return m.to
 }
 
+// UCI returns the move in the long algebraic notation of the Universal
+// Chess Interface, e.g. "e2e4" or "e7e8q".
+func (m *Move) UCI() string {
+	s := m.from.String() + m.to.String()
+	if m.isPromotion {
+		s += string(unicode.ToLower(rune(sanLetters[m.promotion])))
+	}
+	return s
+}
+
+// ParseUCIMove returns the legal move given in the long algebraic notation
+// of the Universal Chess Interface, e.g. "e2e4" or "e7e8q".
+func ParseUCIMove(game *Game, s string) (Move, error) {
+	if len(s) != 4 && len(s) != 5 {
+		return Move{}, fmt.Errorf("invalid UCI move %q", s)
+	}
+	from, err := ParsePosition(s[0:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid UCI move %q: %w", s, err)
+	}
+	to, err := ParsePosition(s[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid UCI move %q: %w", s, err)
+	}
+	var promotion *PieceType
+	if len(s) == 5 {
+		i := strings.IndexRune(sanLetters[1:], unicode.ToUpper(rune(s[4])))
+		if i < 0 {
+			return Move{}, fmt.Errorf("invalid UCI move %q: unknown promotion piece", s)
+		}
+		pt := PieceType(i + 1)
+		promotion = &pt
+	}
+	m, ok := game.LegalMove(from, to, promotion)
+	if !ok || m.isPromotion != (promotion != nil) {
+		return Move{}, fmt.Errorf("illegal move %q", s)
+	}
+	return m, nil
+}
+
 func AlgebraicToMove(board *Board, moveStr string) *Move {
 	fromCol := int(moveStr[0] - 'a')
 	fromRow := 8 - int(moveStr[1]-'0')
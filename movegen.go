@@ -0,0 +1,51 @@
+package chess
+
+var (
+	knightOffsets = [8][2]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
+	kingOffsets   = [8][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+	rookDirs      = [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	bishopDirs    = [4][2]int{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}}
+
+	promotionTypes = [4]PieceType{Queen, Rook, Bishop, Knight}
+)
+
+// GenerateLegalMoves returns all strictly legal moves for the side to move,
+// including castling, en passant and one move per promotion choice.
+func GenerateLegalMoves(game *Game) []Move {
+	return generateLegalMoves(game.Board(), game.EnPassantTarget(), game.Turn())
+}
+
+func generateLegalMoves(board *Board, ep *Position, color Color) []Move {
+	pos := NewBitPosition(board, color, ep)
+	var moves []Move
+	legal := pos.legalMoves()
+	for _, m := range legal {
+		moves = append(moves, pos.toMove(board, m, legal))
+	}
+	return moves
+}
+
+// applyMove plays a move on the board, including the rook move of a
+// castling, the removal of a pawn captured en passant and promotion.
+func applyMove(board *Board, m Move) {
+	from, to := m.from, m.to
+	piece := board.PieceAt(from.Row, from.Col)
+
+	if piece.Type() == Pawn && to.Col != from.Col && board.PieceAt(to.Row, to.Col) == nil {
+		board.SetPieceAt(from.Row, to.Col, nil)
+	}
+	if rookFrom, rookTo, ok := castlingRookMove(piece, m); ok {
+		board.MovePiece(rookFrom, rookTo)
+		board.PieceAt(rookTo.Row, rookTo.Col).SetHasMoved(true)
+	}
+
+	board.MovePiece(from, to)
+	piece.SetHasMoved(true)
+	if m.isPromotion {
+		piece.SetType(m.promotion)
+	}
+}
+
+func onBoard(p Position) bool {
+	return p.Row >= 0 && p.Row < 8 && p.Col >= 0 && p.Col < 8
+}
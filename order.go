@@ -0,0 +1,109 @@
+package chess
+
+// Move ordering scores: the hash move first, then captures and promotions
+// by MVV-LVA, killer moves and the other quiet moves by history score.
+const (
+	scoreHashMove   = 1 << 30
+	scoreCapture    = 1 << 20
+	scoreKiller     = 1 << 19
+	maxHistoryScore = 1 << 18
+)
+
+// orderMoves sorts the moves of a ply in the order they are searched.
+func (s *searcher) orderMoves(pos *BitPosition, moves []bitMove, scores []int, hashMove bitMove, ply int) {
+	killers := &s.killers[ply]
+	history := &s.history[pos.turn]
+	for _, m := range moves {
+		var score int
+		switch {
+		case m == hashMove:
+			score = scoreHashMove
+		case pos.isTactical(m):
+			score = scoreCapture + pos.mvvLva(m)
+		case m == killers[0]:
+			score = scoreKiller + 1
+		case m == killers[1]:
+			score = scoreKiller
+		default:
+			score = history[m.from()][m.to()]
+		}
+		scores = append(scores, score)
+	}
+	sortMoves(moves, scores)
+}
+
+// rememberQuiet records a quiet move that caused a beta cutoff as killer
+// move of the ply and raises its history score.
+func (s *searcher) rememberQuiet(pos *BitPosition, m bitMove, depth, ply int) {
+	if killers := &s.killers[ply]; killers[0] != m {
+		killers[1], killers[0] = killers[0], m
+	}
+	history := &s.history[pos.turn]
+	history[m.from()][m.to()] += depth * depth
+	if history[m.from()][m.to()] >= maxHistoryScore {
+		for from := range history {
+			for to := range history[from] {
+				history[from][to] /= 2
+			}
+		}
+	}
+}
+
+// isTactical tells whether a move captures or promotes.
+func (p *BitPosition) isTactical(m bitMove) bool {
+	if p.squares[m.to()] != noPiece {
+		return true
+	}
+	if _, ok := m.promotion(); ok {
+		return true
+	}
+	_, pt, _ := p.pieceAt(m.from())
+	return pt == Pawn && m.from()%8 != m.to()%8
+}
+
+// lvaOrder ranks the attackers for MVV-LVA, the least valuable first.
+var lvaOrder = [6]int{Pawn: 1, Knight: 2, Bishop: 3, Rook: 4, Queen: 5, King: 6}
+
+// mvvLva scores a capture by the most valuable victim first and, among
+// captures of the same victim, the least valuable attacker first. Queen
+// promotions count as capturing the value a queen adds.
+func (p *BitPosition) mvvLva(m bitMove) int {
+	_, attacker, _ := p.pieceAt(m.from())
+	score := -lvaOrder[attacker]
+	if _, victim, ok := p.pieceAt(m.to()); ok {
+		score += 10 * getPieceValue(victim)
+	} else if attacker == Pawn && m.from()%8 != m.to()%8 {
+		score += 10 * getPieceValue(Pawn)
+	}
+	if pt, ok := m.promotion(); ok {
+		score += 10 * (getPieceValue(pt) - getPieceValue(Pawn))
+	}
+	return score
+}
+
+// captureValue returns the material a capture or promotion wins at most.
+func (p *BitPosition) captureValue(m bitMove) int {
+	value := 0
+	if _, victim, ok := p.pieceAt(m.to()); ok {
+		value = getPieceValue(victim)
+	} else if m.from()%8 != m.to()%8 {
+		value = getPieceValue(Pawn) // en passant
+	}
+	if pt, ok := m.promotion(); ok {
+		value += getPieceValue(pt) - getPieceValue(Pawn)
+	}
+	return value
+}
+
+// sortMoves sorts moves by descending score. Move lists are short, so an
+// insertion sort is fast enough.
+func sortMoves(moves []bitMove, scores []int) {
+	for i := 1; i < len(moves); i++ {
+		m, sc := moves[i], scores[i]
+		j := i
+		for ; j > 0 && scores[j-1] < sc; j-- {
+			moves[j], scores[j] = moves[j-1], scores[j-1]
+		}
+		moves[j], scores[j] = m, sc
+	}
+}
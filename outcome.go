@@ -0,0 +1,243 @@
+package chess
+
+import "fmt"
+
+// Result is the result of a game.
+type Result int
+
+const (
+	Ongoing Result = iota
+	WhiteWins
+	BlackWins
+	Draw
+)
+
+// String returns the result as written in PGN, e.g. "1-0".
+func (r Result) String() string {
+	switch r {
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Draw:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+// Termination is the reason a game has ended.
+type Termination int
+
+const (
+	NoTermination Termination = iota
+	Checkmate
+	Stalemate
+	Repetition
+	Resignation
+	Timeout
+	Agreement
+	FiftyMoveRule // claimed after 50 moves without capture or pawn move
+	InsufficientMaterial
+	SeventyFiveMoveRule // automatic after 75 moves without capture or pawn move
+)
+
+func (t Termination) String() string {
+	switch t {
+	case Checkmate:
+		return "checkmate"
+	case Stalemate:
+		return "stalemate"
+	case Repetition:
+		return "repetition"
+	case Resignation:
+		return "resignation"
+	case Timeout:
+		return "timeout"
+	case Agreement:
+		return "agreement"
+	case FiftyMoveRule:
+		return "fifty-move rule"
+	case InsufficientMaterial:
+		return "insufficient material"
+	case SeventyFiveMoveRule:
+		return "seventy-five-move rule"
+	}
+	return "none"
+}
+
+// Outcome is the result of a game together with the reason it has ended.
+type Outcome struct {
+	Result      Result
+	Termination Termination
+}
+
+// String describes the outcome, e.g. "White wins by checkmate".
+func (o Outcome) String() string {
+	switch o.Result {
+	case WhiteWins:
+		return "White wins by " + o.Termination.String()
+	case BlackWins:
+		return "Black wins by " + o.Termination.String()
+	case Draw:
+		return "Draw by " + o.Termination.String()
+	}
+	return "Ongoing"
+}
+
+// winner returns the result of a win of the given color.
+func winner(c Color) Result {
+	if c == White {
+		return WhiteWins
+	}
+	return BlackWins
+}
+
+// Outcome returns the outcome of the game: the end set by Resign, Timeout,
+// AgreeDraw or ClaimDraw, or else checkmate, stalemate or one of the draws
+// that end the game automatically (insufficient material, the 75-move rule
+// and fivefold repetition). Checkmate takes precedence over the draws.
+func (g *Game) Outcome() Outcome {
+	if g.outcome.Result != Ongoing {
+		return g.outcome
+	}
+	if len(GenerateLegalMoves(g)) == 0 {
+		if isCheck(g.board, g.turn) {
+			return Outcome{winner(opposite(g.turn)), Checkmate}
+		}
+		return Outcome{Draw, Stalemate}
+	}
+	if isInsufficientMaterial(g.board) {
+		return Outcome{Draw, InsufficientMaterial}
+	}
+	if g.halfmoveClock >= 150 {
+		return Outcome{Draw, SeventyFiveMoveRule}
+	}
+	if g.repetitions() >= 5 {
+		return Outcome{Draw, Repetition}
+	}
+	return Outcome{}
+}
+
+// ClaimableDraw returns the reason a draw can be claimed in the current
+// position, by the 50-move rule or threefold repetition, or NoTermination.
+func (g *Game) ClaimableDraw() Termination {
+	if g.halfmoveClock >= 100 {
+		return FiftyMoveRule
+	}
+	if g.repetitions() >= 3 {
+		return Repetition
+	}
+	return NoTermination
+}
+
+// ClaimDraw ends the game in a draw if one can be claimed.
+func (g *Game) ClaimDraw() error {
+	t := g.ClaimableDraw()
+	if t == NoTermination {
+		return fmt.Errorf("no draw can be claimed")
+	}
+	return g.end(Outcome{Draw, t})
+}
+
+// Resign ends the game with a win of the opponent of the given color.
+func (g *Game) Resign(c Color) error {
+	return g.end(Outcome{winner(opposite(c)), Resignation})
+}
+
+// Timeout ends the game with a win of the opponent of the given color,
+// whose time has run out.
+func (g *Game) Timeout(c Color) error {
+	return g.end(Outcome{winner(opposite(c)), Timeout})
+}
+
+// AgreeDraw ends the game in a draw by agreement.
+func (g *Game) AgreeDraw() error {
+	return g.end(Outcome{Draw, Agreement})
+}
+
+func (g *Game) end(o Outcome) error {
+	if g.Outcome().Result != Ongoing {
+		return fmt.Errorf("game is already over")
+	}
+	g.outcome = o
+	return nil
+}
+
+// repetitions returns how often the current position has occurred in the
+// game, including the current occurrence.
+func (g *Game) repetitions() int {
+	return len(g.RepetitionPlies()) + 1
+}
+
+// IsThreefoldRepetition tells whether the current position has occurred
+// at least three times in the game.
+func (g *Game) IsThreefoldRepetition() bool {
+	return g.repetitions() >= 3
+}
+
+// IsThreefoldRepetition tells whether the last board of history has the
+// same pieces on the same squares as at least two boards before it.
+//
+// Deprecated: Use Game.IsThreefoldRepetition, which also compares the side
+// to move, castling rights and en passant captures as the rules require.
+func IsThreefoldRepetition(history []*Board) bool {
+	if len(history) == 0 {
+		return false
+	}
+	last := history[len(history)-1].FEN()
+	count := 0
+	for _, board := range history {
+		if board.FEN() == last {
+			count++
+		}
+	}
+	return count >= 3
+}
+
+// RepetitionPlies returns the plies, counted from the start position of the
+// game, after which the current position has occurred before, in ascending
+// order. Positions are the same as in the FIDE rules: the same pieces on
+// the same squares, the same side to move, the same castling rights and
+// the same possibility to capture en passant. Only positions since the
+// last capture or pawn move can be repeated.
+func (g *Game) RepetitionPlies() []int {
+	var plies []int
+	h := g.Hash()
+	for i := len(g.undos) - 1; i >= 0 && i >= len(g.undos)-g.halfmoveClock; i-- {
+		if g.undos[i].hash == h {
+			plies = append([]int{i}, plies...)
+		}
+	}
+	return plies
+}
+
+// isInsufficientMaterial tells whether neither side can checkmate by any
+// sequence of legal moves: king against king, king and minor piece against
+// king, or only bishops besides the kings, all on squares of one colour.
+func isInsufficientMaterial(board *Board) bool {
+	var minors, knights int
+	bishopSquares := [2]bool{}
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			p := board[r][c]
+			if p == nil {
+				continue
+			}
+			switch p.pieceType {
+			case King:
+			case Knight:
+				minors++
+				knights++
+			case Bishop:
+				minors++
+				bishopSquares[(r+c)%2] = true
+			default:
+				return false
+			}
+		}
+	}
+	if minors <= 1 {
+		return true
+	}
+	return knights == 0 && !(bishopSquares[0] && bishopSquares[1])
+}
@@ -0,0 +1,48 @@
+package chess
+
+// Perft counts the leaf nodes of the legal move tree of the given depth.
+// Comparing the counts with published reference values is the standard
+// way to verify a move generator.
+func Perft(game *Game, depth int) uint64 {
+	return perft(game.BitPosition(), depth)
+}
+
+// PerftDivide returns the perft count below each legal move, keyed by the
+// move in UCI notation. The counts add up to Perft(game, depth).
+func PerftDivide(game *Game, depth int) map[string]uint64 {
+	divide := make(map[string]uint64)
+	if depth < 1 {
+		return divide
+	}
+	pos := game.BitPosition()
+	board := game.Board()
+	legal := pos.legalMoves()
+	for _, m := range legal {
+		child := *pos
+		child.makeMove(m)
+		move := pos.toMove(board, m, legal)
+		divide[move.UCI()] = perft(&child, depth-1)
+	}
+	return divide
+}
+
+func perft(pos *BitPosition, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	var nodes uint64
+	var buf [256]bitMove
+	for _, m := range pos.generateMoves(buf[:0]) {
+		child := *pos
+		child.makeMove(m)
+		if child.inCheck(pos.turn) {
+			continue
+		}
+		if depth == 1 {
+			nodes++
+		} else {
+			nodes += perft(&child, depth-1)
+		}
+	}
+	return nodes
+}
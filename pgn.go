@@ -6,7 +6,27 @@ import (
 	"time"
 )
 
+// ExportToPGN returns the moves of a game from the standard start position
+// in PGN. Its result is unknown; ExportGameToPGN also writes the outcome
+// and the start position of a game.
 func ExportToPGN(moveLog *MoveLog, whitePlayer, blackPlayer string) string {
+	return writePGN(moveLog, whitePlayer, blackPlayer, Outcome{}, "", White, 1)
+}
+
+// ExportGameToPGN returns the moves and the outcome of the game in PGN. A
+// game that did not start from the standard position gets the SetUp and
+// FEN tags, and its moves are numbered from its first move.
+func ExportGameToPGN(game *Game, whitePlayer, blackPlayer string) string {
+	turn, fullmove := White, 1
+	if game.startFEN != "" {
+		if start, err := ParseFEN(game.startFEN); err == nil {
+			turn, fullmove = start.turn, start.fullmoveNumber
+		}
+	}
+	return writePGN(game.moveLog, whitePlayer, blackPlayer, game.Outcome(), game.startFEN, turn, fullmove)
+}
+
+func writePGN(moveLog *MoveLog, whitePlayer, blackPlayer string, outcome Outcome, fen string, turn Color, fullmove int) string {
 	var sb strings.Builder
 
 	// PGN headers
@@ -16,17 +36,43 @@ func ExportToPGN(moveLog *MoveLog, whitePlayer, blackPlayer string) string {
 	sb.WriteString(fmt.Sprintf("[Round \"%s\"]\n", "1"))
 	sb.WriteString(fmt.Sprintf("[White \"%s\"]\n", whitePlayer))
 	sb.WriteString(fmt.Sprintf("[Black \"%s\"]\n", blackPlayer))
-	sb.WriteString(fmt.Sprintf("[Result \"%s\"]\n", "*")) // TODO: determine result
+	sb.WriteString(fmt.Sprintf("[Result \"%s\"]\n", outcome.Result))
+	if fen != "" {
+		sb.WriteString("[SetUp \"1\"]\n")
+		sb.WriteString(fmt.Sprintf("[FEN \"%s\"]\n", fen))
+	}
+	sb.WriteString(fmt.Sprintf("[Termination \"%s\"]\n", pgnTermination(outcome)))
 	sb.WriteString("\n")
 
 	// Move text
 	for i, move := range moveLog.moves {
-		if i%2 == 0 {
-			sb.WriteString(fmt.Sprintf("%d. ", i/2+1))
+		if turn == White {
+			sb.WriteString(fmt.Sprintf("%d. ", fullmove))
+		} else if i == 0 {
+			sb.WriteString(fmt.Sprintf("%d... ", fullmove))
 		}
 		sb.WriteString(move.notation)
 		sb.WriteString(" ")
+		if turn == Black {
+			fullmove++
+		}
+		turn = opposite(turn)
 	}
+	sb.WriteString(outcome.Result.String())
+	sb.WriteString("\n")
 
 	return sb.String()
 }
+
+// pgnTermination returns the value of the Termination tag of an outcome.
+// The PGN standard only knows a few reasons; all ends by the rules of the
+// game or by the players are "normal".
+func pgnTermination(o Outcome) string {
+	switch {
+	case o.Result == Ongoing:
+		return "unterminated"
+	case o.Termination == Timeout:
+		return "time forfeit"
+	}
+	return "normal"
+}
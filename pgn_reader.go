@@ -0,0 +1,387 @@
+package chess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PGNGame is a single game read from a PGN file.
+type PGNGame struct {
+	Tags     []PGNTag
+	Comments []string // comments before the first move
+	Moves    []*PGNMove
+	Result   string
+
+	game *Game
+}
+
+// PGNTag is a tag pair of a PGN header, e.g. [White "Kasparov"].
+type PGNTag struct {
+	Name  string
+	Value string
+}
+
+// PGNMove is a move of the mainline or of a variation, together with its
+// annotations and the variations that may be played instead of it.
+type PGNMove struct {
+	Move       Move
+	Before     []string // comments in front of the first move of a variation
+	Comments   []string
+	NAGs       []int
+	Variations [][]*PGNMove
+}
+
+// Tag returns the value of the tag with the given name, or "" if the game
+// has no such tag.
+func (pg *PGNGame) Tag(name string) string {
+	for _, t := range pg.Tags {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// Game returns the game with the mainline replayed onto it.
+func (pg *PGNGame) Game() *Game {
+	return pg.game
+}
+
+var nagSymbols = map[string]int{
+	"!":  1,
+	"?":  2,
+	"!!": 3,
+	"??": 4,
+	"!?": 5,
+	"?!": 6,
+}
+
+// ParsePGN reads all games of a PGN file. The moves of the mainline and of
+// all variations are checked for legality while they are replayed.
+func ParsePGN(r io.Reader) ([]*PGNGame, error) {
+	p := &pgnParser{r: bufio.NewReader(r), line: 1, nextBol: true}
+	var games []*PGNGame
+	for {
+		pg, err := p.parseGame()
+		if err != nil {
+			return games, fmt.Errorf("game %d, line %d: %w", len(games)+1, p.line, err)
+		}
+		if pg == nil {
+			return games, nil
+		}
+		games = append(games, pg)
+	}
+}
+
+type pgnTokenKind int
+
+const (
+	tokEOF pgnTokenKind = iota
+	tokTag
+	tokComment
+	tokOpen
+	tokClose
+	tokNAG
+	tokSymbol
+)
+
+type pgnToken struct {
+	kind  pgnTokenKind
+	text  string
+	value string // tag value of a tokTag
+}
+
+type pgnParser struct {
+	r      *bufio.Reader
+	line   int
+	peeked *pgnToken
+
+	// bol tells whether the last rune read was the first of a line.
+	bol, prevBol, nextBol bool
+}
+
+func (p *pgnParser) parseGame() (*PGNGame, error) {
+	pg := &PGNGame{}
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != tokTag {
+			break
+		}
+		p.peeked = nil
+		pg.Tags = append(pg.Tags, PGNTag{Name: tok.text, Value: tok.value})
+	}
+
+	game := NewGame()
+	if fen := pg.Tag("FEN"); fen != "" {
+		g, err := ParseFEN(fen)
+		if err != nil {
+			return nil, err
+		}
+		game = g
+	}
+
+	moves, comments, result, err := p.parseLine(game, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pg.Tags) == 0 && len(moves) == 0 && len(comments) == 0 && result == "" {
+		return nil, nil
+	}
+	pg.Moves, pg.Comments, pg.Result, pg.game = moves, comments, result, game
+	if pg.Result == "" {
+		pg.Result = pg.Tag("Result")
+	}
+	return pg, nil
+}
+
+// parseLine reads moves until the end of a variation (depth > 0) or the
+// end of the game and plays them on game. Comments in front of the first
+// move are returned separately.
+func (p *pgnParser) parseLine(game *Game, depth int) (moves []*PGNMove, comments []string, result string, err error) {
+	var before *Game
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		var last *PGNMove
+		if len(moves) > 0 {
+			last = moves[len(moves)-1]
+		}
+
+		switch tok.kind {
+		case tokEOF:
+			if depth > 0 {
+				return nil, nil, "", fmt.Errorf("unterminated variation")
+			}
+			return moves, comments, "", nil
+		case tokTag:
+			if depth > 0 {
+				return nil, nil, "", fmt.Errorf("unterminated variation")
+			}
+			return moves, comments, "", nil
+		case tokClose:
+			p.peeked = nil
+			if depth == 0 {
+				return nil, nil, "", fmt.Errorf("unexpected ')'")
+			}
+			return moves, comments, "", nil
+		case tokComment:
+			p.peeked = nil
+			if last == nil {
+				comments = append(comments, tok.text)
+			} else {
+				last.Comments = append(last.Comments, tok.text)
+			}
+		case tokNAG:
+			p.peeked = nil
+			if last == nil {
+				return nil, nil, "", fmt.Errorf("NAG %q without move", tok.text)
+			}
+			nag, err := strconv.Atoi(tok.text)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("invalid NAG %q", tok.text)
+			}
+			last.NAGs = append(last.NAGs, nag)
+		case tokOpen:
+			p.peeked = nil
+			if last == nil {
+				return nil, nil, "", fmt.Errorf("variation without move")
+			}
+			variation, varComments, _, err := p.parseLine(before.clone(), depth+1)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			if len(variation) > 0 {
+				variation[0].Before = varComments
+				last.Variations = append(last.Variations, variation)
+			}
+		case tokSymbol:
+			p.peeked = nil
+			sym := tok.text
+			if isPGNResult(sym) {
+				if depth > 0 {
+					return nil, nil, "", fmt.Errorf("result %q inside variation", sym)
+				}
+				return moves, comments, sym, nil
+			}
+			sym = stripMoveNumber(sym)
+			if strings.Trim(sym, ".") == "" {
+				continue
+			}
+			san := strings.TrimRight(sym, "!?")
+			m, err := ParseSAN(game, san)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			pm := &PGNMove{Move: m}
+			if suffix := sym[len(san):]; suffix != "" {
+				nag, ok := nagSymbols[suffix]
+				if !ok {
+					return nil, nil, "", fmt.Errorf("invalid move annotation %q", suffix)
+				}
+				pm.NAGs = append(pm.NAGs, nag)
+			}
+			before = game.clone()
+			game.play(m)
+			pm.Move.notation = game.moveLog.LastMove().notation
+			pm.Move.checkStatus = game.moveLog.LastMove().checkStatus
+			moves = append(moves, pm)
+		}
+	}
+}
+
+func isPGNResult(s string) bool {
+	return s == "1-0" || s == "0-1" || s == "1/2-1/2" || s == "*"
+}
+
+// stripMoveNumber removes a leading move number indication like "12." or
+// "12..." from a symbol.
+func stripMoveNumber(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == len(s) {
+		return ""
+	}
+	if s[i] != '.' {
+		return s
+	}
+	return strings.TrimLeft(s[i:], ".")
+}
+
+func (p *pgnParser) peek() (*pgnToken, error) {
+	if p.peeked == nil {
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		p.peeked = tok
+	}
+	return p.peeked, nil
+}
+
+func (p *pgnParser) readRune() (rune, bool) {
+	r, _, err := p.r.ReadRune()
+	if err != nil {
+		return 0, false
+	}
+	if r == '\n' {
+		p.line++
+	}
+	p.prevBol, p.bol, p.nextBol = p.bol, p.nextBol, r == '\n'
+	return r, true
+}
+
+func (p *pgnParser) unreadRune(r rune) {
+	p.r.UnreadRune()
+	if r == '\n' {
+		p.line--
+	}
+	p.nextBol, p.bol = p.bol, p.prevBol
+}
+
+func (p *pgnParser) next() (*pgnToken, error) {
+	for {
+		r, ok := p.readRune()
+		if !ok {
+			return &pgnToken{kind: tokEOF}, nil
+		}
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case r == '%' && p.bol:
+			p.readUntil('\n')
+			continue
+		case r == '[':
+			return p.readTag()
+		case r == '{':
+			text, ok := p.readUntil('}')
+			if !ok {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			return &pgnToken{kind: tokComment, text: strings.TrimSpace(text)}, nil
+		case r == ';':
+			text, _ := p.readUntil('\n')
+			return &pgnToken{kind: tokComment, text: strings.TrimSpace(text)}, nil
+		case r == '(':
+			return &pgnToken{kind: tokOpen}, nil
+		case r == ')':
+			return &pgnToken{kind: tokClose}, nil
+		case r == '$':
+			return &pgnToken{kind: tokNAG, text: p.readSymbol("")}, nil
+		default:
+			return &pgnToken{kind: tokSymbol, text: p.readSymbol(string(r))}, nil
+		}
+	}
+}
+
+// readUntil reads up to and including the delimiter and returns the text
+// before it. ok is false if the input ended before the delimiter.
+func (p *pgnParser) readUntil(delim rune) (string, bool) {
+	var sb strings.Builder
+	for {
+		r, ok := p.readRune()
+		if !ok {
+			return sb.String(), false
+		}
+		if r == delim {
+			return sb.String(), true
+		}
+		sb.WriteRune(r)
+	}
+}
+
+func (p *pgnParser) readSymbol(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for {
+		r, ok := p.readRune()
+		if !ok {
+			return sb.String()
+		}
+		if unicode.IsSpace(r) || strings.ContainsRune("[]{}();$", r) {
+			p.unreadRune(r)
+			return sb.String()
+		}
+		sb.WriteRune(r)
+	}
+}
+
+func (p *pgnParser) readTag() (*pgnToken, error) {
+	text, ok := p.readUntil('"')
+	if !ok {
+		return nil, fmt.Errorf("invalid tag pair")
+	}
+	name := strings.TrimSpace(text)
+	var value strings.Builder
+	for {
+		r, ok := p.readRune()
+		if !ok {
+			return nil, fmt.Errorf("unterminated tag %q", name)
+		}
+		if r == '\\' {
+			if r, ok = p.readRune(); !ok {
+				return nil, fmt.Errorf("unterminated tag %q", name)
+			}
+		} else if r == '"' {
+			break
+		}
+		value.WriteRune(r)
+	}
+	if rest, ok := p.readUntil(']'); !ok || strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("invalid tag %q", name)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("tag without name")
+	}
+	return &pgnToken{kind: tokTag, text: name, value: value.String()}, nil
+}
@@ -0,0 +1,121 @@
+package chess
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPGN = `% an escape line, ignored
+[Event "Test \"quoted\" \\ game"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+{Opening comment} 1. e4 $1 e5!? 2. Nf3 ; to the end of the line
+Nc6 (2... d6 {Philidor} 3. d4 (3. Bc4 Be7) exd4) 3. Bb5?! a6 $6 {Ruy}
+% another one between the moves
+1-0
+
+[Event "Second"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+
+1. e4 Kd7 *
+`
+
+func notations(moves []*PGNMove) []string {
+	var s []string
+	for _, m := range moves {
+		s = append(s, m.Move.Notation())
+	}
+	return s
+}
+
+func TestParsePGN(t *testing.T) {
+	games, err := ParsePGN(strings.NewReader(testPGN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("got %d games, want 2", len(games))
+	}
+
+	g := games[0]
+	if got := g.Tag("Event"); got != `Test "quoted" \ game` {
+		t.Errorf("got Event %q", got)
+	}
+	if g.Tag("Site") != "" || len(g.Tags) != 4 {
+		t.Errorf("got tags %v", g.Tags)
+	}
+	if !reflect.DeepEqual(g.Comments, []string{"Opening comment"}) {
+		t.Errorf("got comments %q before the moves", g.Comments)
+	}
+	if got, want := notations(g.Moves), []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got mainline %v, want %v", got, want)
+	}
+	m := g.Moves
+	if !reflect.DeepEqual(m[0].NAGs, []int{1}) || !reflect.DeepEqual(m[1].NAGs, []int{5}) ||
+		!reflect.DeepEqual(m[4].NAGs, []int{6}) || !reflect.DeepEqual(m[5].NAGs, []int{6}) {
+		t.Errorf("got NAGs %v %v %v %v", m[0].NAGs, m[1].NAGs, m[4].NAGs, m[5].NAGs)
+	}
+	if !reflect.DeepEqual(m[2].Comments, []string{"to the end of the line"}) || !reflect.DeepEqual(m[5].Comments, []string{"Ruy"}) {
+		t.Errorf("got comments %q and %q", m[2].Comments, m[5].Comments)
+	}
+	if len(m[3].Variations) != 1 {
+		t.Fatalf("got %d variations of Nc6, want 1", len(m[3].Variations))
+	}
+	v := m[3].Variations[0]
+	if got, want := notations(v), []string{"d6", "d4", "exd4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got variation %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(v[0].Comments, []string{"Philidor"}) {
+		t.Errorf("got comments %q of d6", v[0].Comments)
+	}
+	if len(v[1].Variations) != 1 || !reflect.DeepEqual(notations(v[1].Variations[0]), []string{"Bc4", "Be7"}) {
+		t.Errorf("got variations %v of d4", v[1].Variations)
+	}
+	if g.Result != "1-0" {
+		t.Errorf("got result %q", g.Result)
+	}
+	if got, want := g.Game().FEN(), "r1bqkbnr/1ppp1ppp/p1n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 0 4"; got != want {
+		t.Errorf("got position %s, want %s", got, want)
+	}
+
+	g = games[1]
+	if got := notations(g.Moves); !reflect.DeepEqual(got, []string{"e4", "Kd7"}) {
+		t.Errorf("got moves %v of the second game", got)
+	}
+	if got, want := g.Game().FEN(), "8/3k4/8/8/4P3/8/8/4K3 w - - 1 2"; got != want {
+		t.Errorf("got position %s, want %s", got, want)
+	}
+	if g.Result != "*" {
+		t.Errorf("got result %q", g.Result)
+	}
+}
+
+func TestParsePGNErrors(t *testing.T) {
+	tests := []struct {
+		pgn, err string
+	}{
+		{"1. e4 (1. d4 d5 2. c4", "unterminated variation"},
+		{"1. e4 (1. d4 d5\n\n[Event \"Next\"]\n1. e4 *", "unterminated variation"},
+		{"1. e4 e5 2. Ke3 *", "illegal move"},
+		{"1. e4 e5 (2. Nf3) *", "illegal move"},
+		{"1. e4 {unterminated", "unterminated comment"},
+		{"1. e4 ) *", "unexpected ')'"},
+		{"$1 1. e4 *", "without move"},
+		{"( 1. e4 ) *", "variation without move"},
+		{"1. e4 (1. d4 1-0) *", "inside variation"},
+		{"1. e4?x *", "invalid"},
+		{"[Event \"x", "unterminated tag"},
+		{"[FEN \"8/8/8/8/8/8/8/8 w - - 0 1\"]\n*", "king"},
+		{"1. e4 *\n\n1. e4 e5 2. Bc5 *", "game 2"},
+	}
+	for _, tc := range tests {
+		_, err := ParsePGN(strings.NewReader(tc.pgn))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: got error %v, want one about %q", tc.pgn, err, tc.err)
+		}
+	}
+}
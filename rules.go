@@ -1,6 +1,12 @@
 package chess
 
 func IsValidMove(board *Board, moveLog *MoveLog, from, to Position) bool {
+	return isValidMove(board, enPassantSquare(moveLog), from, to)
+}
+
+// isValidMove is IsValidMove with the en passant target square given
+// explicitly instead of being derived from the last logged move.
+func isValidMove(board *Board, ep *Position, from, to Position) bool {
 	piece := board[from.Row][from.Col]
 	if piece == nil {
 		return false
@@ -8,7 +14,7 @@ func IsValidMove(board *Board, moveLog *MoveLog, from, to Position) bool {
 
 	switch piece.Type() {
 	case Pawn:
-		return isValidPawnMove(board, moveLog, from, to)
+		return isValidPawnMove(board, ep, from, to)
 	case Rook:
 		return isValidRookMove(board, from, to)
 	case Knight:
@@ -18,13 +24,13 @@ func IsValidMove(board *Board, moveLog *MoveLog, from, to Position) bool {
 	case Queen:
 		return isValidQueenMove(board, from, to)
 	case King:
-		return isValidKingMove(board, moveLog, from, to)
+		return isValidKingMove(board, from, to)
 	}
 
 	return false
 }
 
-func isValidPawnMove(board *Board, moveLog *MoveLog, from, to Position) bool {
+func isValidPawnMove(board *Board, ep *Position, from, to Position) bool {
 	piece := board.PieceAt(from.Row, from.Col)
 	dx := to.Col - from.Col
 	dy := to.Row - from.Row
@@ -43,11 +49,8 @@ func isValidPawnMove(board *Board, moveLog *MoveLog, from, to Position) bool {
 			return true
 		}
 		// En passant capture
-		if from.Row == 3 && Abs(dx) == 1 && dy == -1 && board.PieceAt(to.Row, to.Col) == nil {
-			lastMove := moveLog.LastMove()
-			if lastMove != nil && lastMove.piece.Type() == Pawn && lastMove.to.Row == 3 && lastMove.to.Col == to.Col && Abs(lastMove.from.Row-lastMove.to.Row) == 2 {
-				return true
-			}
+		if from.Row == 3 && Abs(dx) == 1 && dy == -1 && ep != nil && *ep == to {
+			return isEnPassantVictim(board.PieceAt(from.Row, to.Col), Black)
 		}
 	} else { // Black
 		// Standard 1-step forward
@@ -63,16 +66,19 @@ func isValidPawnMove(board *Board, moveLog *MoveLog, from, to Position) bool {
 			return true
 		}
 		// En passant capture
-		if from.Row == 4 && Abs(dx) == 1 && dy == 1 && board.PieceAt(to.Row, to.Col) == nil {
-			lastMove := moveLog.LastMove()
-			if lastMove != nil && lastMove.piece.Type() == Pawn && lastMove.to.Row == 4 && lastMove.to.Col == to.Col && Abs(lastMove.from.Row-lastMove.to.Row) == 2 {
-				return true
-			}
+		if from.Row == 4 && Abs(dx) == 1 && dy == 1 && ep != nil && *ep == to {
+			return isEnPassantVictim(board.PieceAt(from.Row, to.Col), White)
 		}
 	}
 	return false
 }
 
+// isEnPassantVictim tells whether p is a pawn of the given color that can
+// be captured en passant.
+func isEnPassantVictim(p *Piece, color Color) bool {
+	return p != nil && p.Type() == Pawn && p.Color() == color
+}
+
 func isValidRookMove(board *Board, from, to Position) bool {
 	dx := to.Col - from.Col
 	dy := to.Row - from.Row
@@ -153,8 +159,8 @@ func isValidQueenMove(board *Board, from, to Position) bool {
 	return isValidRookMove(board, from, to) || isValidBishopMove(board, from, to)
 }
 
-func isValidKingMove(board *Board, moveLog *MoveLog, from, to Position) bool {
-	if isValidCastling(board, moveLog, from, to) {
+func isValidKingMove(board *Board, from, to Position) bool {
+	if isValidCastling(board, from, to) {
 		return true
 	}
 	dx := Abs(to.Col - from.Col)
@@ -168,23 +174,15 @@ func isValidKingMove(board *Board, moveLog *MoveLog, from, to Position) bool {
 }
 
 func IsCheck(board *Board, moveLog *MoveLog, color Color) bool {
+	return isCheck(board, color)
+}
+
+func isCheck(board *Board, color Color) bool {
 	kingPos := findKing(board, color)
 	if kingPos == nil {
 		return false
 	}
-
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			piece := board.PieceAt(r, c)
-			if piece != nil && piece.Color() != color {
-				if IsValidMove(board, moveLog, Position{Row: r, Col: c}, *kingPos) {
-					return true
-				}
-			}
-		}
-	}
-
-	return false
+	return isSquareAttacked(board, kingPos.Row, kingPos.Col, color)
 }
 
 func findKing(board *Board, color Color) *Position {
@@ -207,103 +205,20 @@ func Abs(x int) int {
 }
 
 func IsCheckmate(board *Board, moveLog *MoveLog, color Color) bool {
-	if !IsCheck(board, moveLog, color) {
+	if !isCheck(board, color) {
 		return false
 	}
-
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			piece := board.PieceAt(r, c)
-			if piece != nil && piece.Color() == color {
-				for r2 := 0; r2 < 8; r2++ {
-					for c2 := 0; c2 < 8; c2++ {
-						to := Position{Row: r2, Col: c2}
-						if IsValidMove(board, moveLog, Position{Row: r, Col: c}, to) {
-							// Make the move on a temporary board
-							tempBoard := board.Clone()
-							tempBoard.MovePiece(Position{Row: r, Col: c}, to)
-
-							// Check if the king is in check
-							if !IsCheck(tempBoard, moveLog, color) {
-								return false
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return true
+	return len(generateLegalMoves(board, enPassantSquare(moveLog), color)) == 0
 }
 
 func IsStalemate(board *Board, moveLog *MoveLog, color Color) bool {
-	if IsCheck(board, moveLog, color) {
+	if isCheck(board, color) {
 		return false
 	}
-
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			piece := board.PieceAt(r, c)
-			if piece != nil && piece.Color() == color {
-				for r2 := 0; r2 < 8; r2++ {
-					for c2 := 0; c2 < 8; c2++ {
-						to := Position{Row: r2, Col: c2}
-						if IsValidMove(board, moveLog, Position{Row: r, Col: c}, to) {
-							// Make the move on a temporary board
-							tempBoard := board.Clone()
-							tempBoard.MovePiece(Position{Row: r, Col: c}, to)
-
-							// Check if the king is in check
-							if !IsCheck(tempBoard, moveLog, color) {
-								return false
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return true
-}
-
-func IsThreefoldRepetition(history []*Board) bool {
-	if len(history) < 9 {
-		return false
-	}
-
-	lastBoard := history[len(history)-1]
-	count := 0
-	for _, board := range history {
-		if boardsEqual(lastBoard, board) {
-			count++
-		}
-	}
-
-	return count >= 3
-}
-
-func boardsEqual(b1, b2 *Board) bool {
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			p1 := b1[r][c]
-			p2 := b2[r][c]
-			if p1 == nil && p2 == nil {
-				continue
-			}
-			if p1 == nil || p2 == nil {
-				return false
-			}
-			if p1.Type() != p2.Type() || p1.Color() != p2.Color() {
-				return false
-			}
-		}
-	}
-	return true
+	return len(generateLegalMoves(board, enPassantSquare(moveLog), color)) == 0
 }
 
-func isValidCastling(board *Board, moveLog *MoveLog, from, to Position) bool {
+func isValidCastling(board *Board, from, to Position) bool {
 	piece := board.PieceAt(from.Row, from.Col)
 	if piece == nil || piece.Type() != King || piece.HasMoved() {
 		return false
@@ -317,33 +232,33 @@ func isValidCastling(board *Board, moveLog *MoveLog, from, to Position) bool {
 	}
 
 	// Check if king is in check
-	if IsCheck(board, moveLog, piece.Color()) {
+	if isCheck(board, piece.Color()) {
 		return false
 	}
 
 	// Check for pieces between king and rook
 	if dx > 0 { // Kingside castling
 		rook := board.PieceAt(from.Row, 7)
-		if rook == nil || rook.Type() != Rook || rook.HasMoved() {
+		if rook == nil || rook.Type() != Rook || rook.Color() != piece.Color() || rook.HasMoved() {
 			return false
 		}
 		if board.PieceAt(from.Row, from.Col+1) != nil || board.PieceAt(from.Row, from.Col+2) != nil {
 			return false
 		}
 		// Check if squares king moves through are under attack
-		if isSquareAttacked(board, moveLog, from.Row, from.Col+1, piece.Color()) || isSquareAttacked(board, moveLog, from.Row, from.Col+2, piece.Color()) {
+		if isSquareAttacked(board, from.Row, from.Col+1, piece.Color()) || isSquareAttacked(board, from.Row, from.Col+2, piece.Color()) {
 			return false
 		}
 	} else { // Queenside castling
 		rook := board.PieceAt(from.Row, 0)
-		if rook == nil || rook.Type() != Rook || rook.HasMoved() {
+		if rook == nil || rook.Type() != Rook || rook.Color() != piece.Color() || rook.HasMoved() {
 			return false
 		}
 		if board.PieceAt(from.Row, from.Col-1) != nil || board.PieceAt(from.Row, from.Col-2) != nil || board.PieceAt(from.Row, from.Col-3) != nil {
 			return false
 		}
 		// Check if squares king moves through are under attack
-		if isSquareAttacked(board, moveLog, from.Row, from.Col-1, piece.Color()) || isSquareAttacked(board, moveLog, from.Row, from.Col-2, piece.Color()) {
+		if isSquareAttacked(board, from.Row, from.Col-1, piece.Color()) || isSquareAttacked(board, from.Row, from.Col-2, piece.Color()) {
 			return false
 		}
 	}
@@ -351,16 +266,65 @@ func isValidCastling(board *Board, moveLog *MoveLog, from, to Position) bool {
 	return true
 }
 
-func isSquareAttacked(board *Board, moveLog *MoveLog, row, col int, color Color) bool {
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			piece := board.PieceAt(r, c)
-			if piece != nil && piece.Color() != color {
-				if IsValidMove(board, moveLog, Position{Row: r, Col: c}, Position{Row: row, Col: col}) {
-					return true
-				}
+// isSquareAttacked tells whether a piece of the opponent of color attacks
+// the square. Unlike IsValidMove it also finds pawn attacks on empty
+// squares and does not depend on castling rules.
+func isSquareAttacked(board *Board, row, col int, color Color) bool {
+	attacker := func(r, c int, types ...PieceType) bool {
+		if r < 0 || r > 7 || c < 0 || c > 7 {
+			return false
+		}
+		p := board.PieceAt(r, c)
+		if p == nil || p.Color() == color {
+			return false
+		}
+		for _, pt := range types {
+			if p.Type() == pt {
+				return true
 			}
 		}
+		return false
 	}
-	return false
+
+	// Pawns attack towards the opponent's side.
+	pawnRow := row - 1
+	if color == Black {
+		pawnRow = row + 1
+	}
+	if attacker(pawnRow, col-1, Pawn) || attacker(pawnRow, col+1, Pawn) {
+		return true
+	}
+	for _, o := range knightOffsets {
+		if attacker(row+o[0], col+o[1], Knight) {
+			return true
+		}
+	}
+	for _, o := range kingOffsets {
+		if attacker(row+o[0], col+o[1], King) {
+			return true
+		}
+	}
+	slider := func(dirs [4][2]int, types ...PieceType) bool {
+		for _, d := range dirs {
+			r, c := row+d[0], col+d[1]
+			for r >= 0 && r < 8 && c >= 0 && c < 8 && board.PieceAt(r, c) == nil {
+				r, c = r+d[0], c+d[1]
+			}
+			if attacker(r, c, types...) {
+				return true
+			}
+		}
+		return false
+	}
+	return slider(rookDirs, Rook, Queen) || slider(bishopDirs, Bishop, Queen)
+}
+
+// enPassantSquare returns the square a pawn may capture en passant on,
+// judging by the last move in the log, or nil if there is none.
+func enPassantSquare(moveLog *MoveLog) *Position {
+	lastMove := moveLog.LastMove()
+	if lastMove == nil {
+		return nil
+	}
+	return enPassantSquareAfter(*lastMove)
 }
@@ -0,0 +1,205 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sanLetters holds the SAN letter of each piece type, indexed by PieceType.
+const sanLetters = "KQRBN"
+
+// SAN returns the move in Standard Algebraic Notation, e.g. "Nbd7",
+// "exd8=Q+" or "O-O#". The move has to be legal in the current position.
+func (g *Game) SAN(m Move) string {
+	return g.BitPosition().san(toBitMove(m), nil)
+}
+
+// san returns a legal move of the position in Standard Algebraic Notation.
+// legal are the legal moves of the position, or nil to generate them when
+// a piece move needs disambiguation.
+func (p *BitPosition) san(m bitMove, legal []bitMove) string {
+	var sb strings.Builder
+	from, to := m.from(), m.to()
+	_, pt, _ := p.pieceAt(from)
+	target := Position{Row: to / 8, Col: to % 8}
+
+	switch {
+	case pt == King && to-from == 2:
+		sb.WriteString("O-O")
+	case pt == King && from-to == 2:
+		sb.WriteString("O-O-O")
+	case pt == Pawn:
+		if from%8 != to%8 {
+			sb.WriteByte(byte('a' + from%8))
+			sb.WriteByte('x')
+		}
+		sb.WriteString(target.String())
+		if promotion, ok := m.promotion(); ok {
+			sb.WriteByte('=')
+			sb.WriteByte(sanLetters[promotion])
+		}
+	default:
+		sb.WriteByte(sanLetters[pt])
+		if legal == nil {
+			legal = p.legalMoves()
+		}
+		sb.WriteString(p.disambiguation(m, legal))
+		if p.squares[to] != noPiece {
+			sb.WriteByte('x')
+		}
+		sb.WriteString(target.String())
+	}
+
+	child := *p
+	child.makeMove(m)
+	if child.inCheck(child.turn) {
+		if len(child.legalMoves()) == 0 {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('+')
+		}
+	}
+	return sb.String()
+}
+
+// disambiguation returns the minimal from-square information needed to tell
+// a piece move apart from moves of other pieces of the same type to the
+// same square: nothing, the file, the rank or the full square.
+func (p *BitPosition) disambiguation(m bitMove, legal []bitMove) string {
+	from := m.from()
+	_, pt, _ := p.pieceAt(from)
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, o := range legal {
+		if _, opt, _ := p.pieceAt(o.from()); o.to() != m.to() || o.from() == from || opt != pt {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || o.from()%8 == from%8
+		sameRank = sameRank || o.from()/8 == from/8
+	}
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return string(rune('a' + from%8))
+	case !sameRank:
+		return string(rune('8' - from/8))
+	default:
+		return Position{Row: from / 8, Col: from % 8}.String()
+	}
+}
+
+// ParseSAN returns the legal move described by a move in Standard Algebraic
+// Notation. Check and annotation suffixes are ignored, superfluous
+// disambiguation and promotions without "=" are accepted.
+func ParseSAN(game *Game, s string) (Move, error) {
+	orig := s
+	s = strings.TrimRight(s, "+#!?")
+	legal := GenerateLegalMoves(game)
+
+	if s == "O-O" || s == "0-0" || s == "O-O-O" || s == "0-0-0" {
+		dc := 2
+		if len(s) == 5 {
+			dc = -2
+		}
+		for _, m := range legal {
+			if m.piece.Type() == King && m.to.Col-m.from.Col == dc {
+				return m, nil
+			}
+		}
+		return Move{}, fmt.Errorf("illegal move %q", orig)
+	}
+
+	pt := Pawn
+	if len(s) > 0 {
+		if i := strings.IndexByte(sanLetters, s[0]); i >= 0 {
+			pt = PieceType(i)
+			s = s[1:]
+		}
+	}
+
+	promotion, isPromotion := PieceType(0), false
+	if pt == Pawn && len(s) > 0 {
+		if i := strings.IndexByte(sanLetters[1:], s[len(s)-1]); i >= 0 {
+			promotion, isPromotion = PieceType(i+1), true
+			s = strings.TrimSuffix(s[:len(s)-1], "=")
+		}
+	}
+
+	if len(s) < 2 {
+		return Move{}, fmt.Errorf("invalid SAN %q", orig)
+	}
+	to, err := ParsePosition(s[len(s)-2:])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid SAN %q: %w", orig, err)
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s[:len(s)-2], "x"), "-")
+
+	fromCol, fromRow := -1, -1
+	for _, ch := range s {
+		switch {
+		case ch >= 'a' && ch <= 'h':
+			fromCol = int(ch - 'a')
+		case ch >= '1' && ch <= '8':
+			fromRow = int('8' - ch)
+		default:
+			return Move{}, fmt.Errorf("invalid SAN %q", orig)
+		}
+	}
+
+	var found []Move
+	for _, m := range legal {
+		if m.piece.Type() != pt || m.to != to || m.isPromotion != isPromotion ||
+			(isPromotion && m.promotion != promotion) ||
+			(fromCol >= 0 && m.from.Col != fromCol) ||
+			(fromRow >= 0 && m.from.Row != fromRow) {
+			continue
+		}
+		found = append(found, m)
+	}
+	switch len(found) {
+	case 0:
+		return Move{}, fmt.Errorf("illegal move %q", orig)
+	case 1:
+		return found[0], nil
+	default:
+		return Move{}, fmt.Errorf("ambiguous move %q", orig)
+	}
+}
+
+// LogMove records a legal move in the move log in Standard Algebraic
+// Notation. It has to be called before the move is played on the board.
+func (g *Game) LogMove(m Move) {
+	g.moveLog.AddMove(g.BitPosition(), m)
+}
+
+// LegalMove returns the legal move from one square to another. promotion
+// selects the piece a pawn is promoted to and may be nil otherwise.
+func (g *Game) LegalMove(from, to Position, promotion *PieceType) (Move, bool) {
+	for _, m := range GenerateLegalMoves(g) {
+		if m.from != from || m.to != to {
+			continue
+		}
+		if m.isPromotion && (promotion == nil || *promotion != m.promotion) {
+			continue
+		}
+		return m, true
+	}
+	return Move{}, false
+}
+
+// enPassantSquareAfter returns the en passant target square created by a
+// move, or nil if the move is no double pawn push.
+func enPassantSquareAfter(m Move) *Position {
+	if m.piece.Type() != Pawn || Abs(m.from.Row-m.to.Row) != 2 {
+		return nil
+	}
+	return &Position{Row: (m.from.Row + m.to.Row) / 2, Col: m.to.Col}
+}
+
+func opposite(c Color) Color {
+	if c == White {
+		return Black
+	}
+	return White
+}
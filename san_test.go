@@ -0,0 +1,118 @@
+package chess
+
+import "testing"
+
+func TestSAN(t *testing.T) {
+	tests := []struct {
+		fen, uci, san string
+	}{
+		{StartFEN, "g1f3", "Nf3"},
+		{StartFEN, "e2e4", "e4"},
+		{"7k/8/8/8/8/8/8/1N3N1K w - - 0 1", "b1d2", "Nbd2"}, // file
+		{"7k/8/8/8/8/8/8/1N3N1K w - - 0 1", "f1d2", "Nfd2"},
+		{"7k/8/8/8/8/8/8/1N3N1K w - - 0 1", "b1c3", "Nc3"}, // one knight
+		{"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"}, // rank
+		{"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "a5a3", "R5a3"},
+		{"1k6/8/8/8/4Q2Q/8/8/K6Q w - - 0 1", "h4e1", "Qh4e1"}, // square
+		{"1k6/8/8/8/4Q2Q/8/8/K6Q w - - 0 1", "e4e1", "Qee1"},
+		{"k3r3/8/8/5N2/8/8/4N3/4K3 w - - 0 1", "f5d4", "Nd4"},   // the other knight is pinned
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b7a8q", "bxa8=Q+"}, // promotions
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b7b8q", "b8=Q+"},
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b7b8n", "b8=N"},
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b7a8r", "bxa8=R+"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"}, // mate
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a7", "Ra7"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"}, // castling
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", "O-O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"5k2/8/8/8/8/8/8/4K2R w K - 0 1", "e1g1", "O-O+"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"}, // en passant
+		{"4k3/8/8/8/8/8/3q4/4K3 w - - 0 1", "e1d2", "Kxd2"},   // capture
+		{"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", "d8h4", "Qh4#"},
+	}
+	for _, tc := range tests {
+		game, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ParseUCIMove(game, tc.uci)
+		if err != nil {
+			t.Errorf("%s: %v", tc.fen, err)
+			continue
+		}
+		if got := game.SAN(m); got != tc.san {
+			t.Errorf("%s %s: got SAN %q, want %q", tc.fen, tc.uci, got, tc.san)
+		}
+		if got := m.Notation(); got != tc.san {
+			t.Errorf("%s %s: got notation %q, want %q", tc.fen, tc.uci, got, tc.san)
+		}
+		parsed, err := ParseSAN(game, tc.san)
+		if err != nil || parsed.UCI() != tc.uci {
+			t.Errorf("%s: ParseSAN(%q) = %s, %v, want %s", tc.fen, tc.san, parsed.UCI(), err, tc.uci)
+		}
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	tests := []struct {
+		fen, san, uci string // no uci: the move is rejected
+	}{
+		{StartFEN, "Nf3", "g1f3"},
+		{StartFEN, "Ng1f3", "g1f3"}, // superfluous disambiguation
+		{StartFEN, "Ng1-f3", "g1f3"},
+		{StartFEN, "e4!?", "e2e4"},
+		{StartFEN, "e5", ""},
+		{StartFEN, "Nf4", ""},
+		{StartFEN, "O-O", ""},
+		{StartFEN, "Zz9", ""},
+		{StartFEN, "N", ""},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0", "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0-0+", "e1c1"},
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "bxa8Q", "b7a8q"}, // no "="
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b8=N", "b7b8n"},
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b8", ""}, // promotion piece missing
+		{"r6k/1P6/8/8/8/8/8/2K5 w - - 0 1", "b8=K", ""},
+		{"7k/8/8/8/8/8/8/1N3N1K w - - 0 1", "Nd2", ""}, // ambiguous
+		{"7k/8/8/8/8/8/8/1N3N1K w - - 0 1", "Nbd2", "b1d2"},
+		{"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "Raa3", ""},
+		{"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "R5a3", "a5a3"},
+		{"k3r3/8/8/5N2/8/8/4N3/4K3 w - - 0 1", "Ne2d4", ""}, // pinned
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "exd6", "e5d6"},
+	}
+	for _, tc := range tests {
+		game, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ParseSAN(game, tc.san)
+		switch {
+		case tc.uci == "" && err == nil:
+			t.Errorf("%s: ParseSAN(%q) = %s, want an error", tc.fen, tc.san, m.UCI())
+		case tc.uci != "" && (err != nil || m.UCI() != tc.uci):
+			t.Errorf("%s: ParseSAN(%q) = %s, %v, want %s", tc.fen, tc.san, m.UCI(), err, tc.uci)
+		}
+	}
+}
+
+func TestMoveLogSAN(t *testing.T) {
+	game := NewGame()
+	line := []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Bxc6", "dxc6", "O-O", "Bg4", "h3", "h5", "hxg4", "hxg4", "Nxe5", "Qh4", "Nxg4", "Qh1#"}
+	for _, san := range line {
+		m, err := ParseSAN(game, san)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := game.MakeMove(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	moves := game.MoveLog().Moves()
+	if len(moves) != len(line) {
+		t.Fatalf("got %d moves in the log, want %d", len(moves), len(line))
+	}
+	for i, m := range moves {
+		if m.Notation() != line[i] {
+			t.Errorf("move %d: got %q, want %q", i+1, m.Notation(), line[i])
+		}
+	}
+}
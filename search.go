@@ -0,0 +1,168 @@
+package chess
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxSearchDepth is the deepest iteration Search will start.
+	MaxSearchDepth = 64
+
+	// DefaultThreads is the number of search threads unless changed with
+	// SetThreads.
+	DefaultThreads = 1
+
+	movesToGoEstimate = 30
+	moveOverhead      = 50 * time.Millisecond
+)
+
+var threads = DefaultThreads
+
+// settings is held for reading by every running search and for writing by
+// the functions that change what searches use: the number of threads, the
+// transposition table, the evaluation and the endgame tables. Changing a
+// setting therefore waits until the running searches have ended.
+var settings sync.RWMutex
+
+// SetThreads sets the number of threads of a search. With more than one,
+// the search is a Lazy SMP search: all threads search the same position
+// and share the transposition table, and the result is the one of the main
+// thread. A single thread searches deterministically. SetThreads waits for
+// running searches to end.
+func SetThreads(n int) {
+	if n < 1 {
+		n = 1
+	}
+	settings.Lock()
+	defer settings.Unlock()
+	threads = n
+}
+
+// SearchLimits restricts an iterative deepening search. Zero values mean
+// "no limit"; a search without any limit runs up to MaxSearchDepth.
+type SearchLimits struct {
+	Depth    int
+	Nodes    uint64
+	MoveTime time.Duration
+
+	// Remaining clock time and increment per move of both players and the
+	// number of moves to the next time control.
+	WhiteTime, BlackTime time.Duration
+	WhiteInc, BlackInc   time.Duration
+	MovesToGo            int
+}
+
+// Budget returns the time to spend on a move of the given color, or 0 if
+// the search is not limited by time.
+func (l SearchLimits) Budget(turn Color) time.Duration {
+	if l.MoveTime > 0 {
+		return l.MoveTime
+	}
+	remaining, inc := l.WhiteTime, l.WhiteInc
+	if turn == Black {
+		remaining, inc = l.BlackTime, l.BlackInc
+	}
+	if remaining <= 0 {
+		return 0
+	}
+	mtg := l.MovesToGo
+	if mtg <= 0 {
+		mtg = movesToGoEstimate
+	}
+	t := remaining/time.Duration(mtg) + inc/2
+	if max := remaining - moveOverhead; t > max {
+		t = max
+	}
+	if t < time.Millisecond {
+		t = time.Millisecond
+	}
+	return t
+}
+
+// Search runs an iterative deepening search: the position is searched to
+// depth 1, 2, 3, ... until a limit is reached. The best move of the last
+// completed iteration is returned; the first iteration always completes.
+// onIteration, if not nil, is called with the result of every completed
+// iteration. Nodes are counted over all iterations.
+func Search(game *Game, limits SearchLimits, onIteration func(SearchResult)) SearchResult {
+	return SearchContext(context.Background(), game, limits, onIteration)
+}
+
+// SearchContext is like Search but also ends the search when ctx is
+// cancelled. It then returns promptly with the best move of the last
+// completed iteration.
+func SearchContext(ctx context.Context, game *Game, limits SearchLimits, onIteration func(SearchResult)) SearchResult {
+	best, _ := search(ctx, game, limits, 1, onIteration)
+	return best
+}
+
+// search is SearchContext that also scores the multiPV best root moves
+// exactly. It returns them, best first, as found by the last completed
+// iteration.
+func search(ctx context.Context, game *Game, limits SearchLimits, multiPV int, onIteration func(SearchResult)) (SearchResult, []scoredMove) {
+	settings.RLock()
+	defer settings.RUnlock()
+	start := time.Now()
+	maxDepth := limits.Depth
+	if maxDepth <= 0 || maxDepth > MaxSearchDepth {
+		maxDepth = MaxSearchDepth
+	}
+
+	// Helper threads search the same position until the main search
+	// ends. They only contribute through the shared transposition table.
+	helperCtx, stopHelpers := context.WithCancel(ctx)
+	helpers := make([]*searcher, threads-1)
+	var wg sync.WaitGroup
+	for i := range helpers {
+		h := newSearcher(game)
+		h.done, h.canStop = helperCtx.Done(), true
+		helpers[i] = h
+		wg.Add(1)
+		go func(firstDepth int) {
+			defer wg.Done()
+			for depth := firstDepth; depth <= maxDepth && !h.stopped; depth++ {
+				h.searchRoot(depth)
+			}
+		}(1 + i%2)
+	}
+
+	s := newSearcher(game)
+	s.done = ctx.Done()
+	s.maxNodes = limits.Nodes
+	s.multiPV = multiPV
+	budget := limits.Budget(game.Turn())
+	if budget > 0 {
+		s.deadline = start.Add(budget)
+	}
+
+	var best SearchResult
+	var rootMoves []scoredMove
+	for depth := 1; depth <= maxDepth; depth++ {
+		s.canStop = depth > 1
+		result := s.searchRoot(depth)
+		if s.stopped {
+			break
+		}
+		best, rootMoves = result, s.rootScores
+		if onIteration != nil {
+			onIteration(best)
+		}
+		if best.PV == nil || (s.maxNodes > 0 && s.nodes >= s.maxNodes) {
+			break
+		}
+		// Another iteration takes several times as long as this one.
+		if budget > 0 && time.Since(start) > budget/2 {
+			break
+		}
+	}
+	stopHelpers()
+	wg.Wait()
+	best.Nodes = s.nodes
+	for _, h := range helpers {
+		best.Nodes += h.nodes
+	}
+	best.Stats = s.stats
+	return best, rootMoves
+}
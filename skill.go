@@ -0,0 +1,111 @@
+package chess
+
+import (
+	"context"
+	"math/rand"
+)
+
+// Skill is a playing strength from 0, a beginner, to MaxSkill, the full
+// strength of the engine. Lower levels search less deep and fewer nodes,
+// choose among the better moves at random and now and then play a clearly
+// worse one.
+type Skill int
+
+const (
+	// MaxSkill is the full strength: the search is not weakened.
+	MaxSkill Skill = 20
+
+	// MinElo and MaxElo are the ratings of skill 0 and MaxSkill.
+	MinElo = 800
+	MaxElo = MinElo + int(MaxSkill)*eloPerSkill
+
+	eloPerSkill = 70
+
+	// skillCandidates is the number of best moves a weakened search
+	// scores and chooses from.
+	skillCandidates = 4
+)
+
+// Elo returns the approximate rating of a skill level. It is a rough
+// estimate against human players, not a measured rating.
+func (sk Skill) Elo() int {
+	return MinElo + int(sk.clamp())*eloPerSkill
+}
+
+// SkillForElo returns the skill level whose rating is closest to elo.
+func SkillForElo(elo int) Skill {
+	return Skill((elo - MinElo + eloPerSkill/2) / eloPerSkill).clamp()
+}
+
+func (sk Skill) clamp() Skill {
+	return min(max(sk, 0), MaxSkill)
+}
+
+// Limit restricts the depth and the nodes of a search to the skill level.
+func (sk Skill) Limit(l SearchLimits) SearchLimits {
+	sk = sk.clamp()
+	if sk == MaxSkill {
+		return l
+	}
+	if depth := 1 + int(sk)/4; l.Depth == 0 || depth < l.Depth {
+		l.Depth = depth
+	}
+	if nodes := uint64(1000) << (sk / 2); l.Nodes == 0 || nodes < l.Nodes {
+		l.Nodes = nodes
+	}
+	return l
+}
+
+// Search is like SearchContext, but plays at the skill level: the search
+// is restricted by Limit, and below MaxSkill it scores the best few moves
+// exactly and the move is chosen at random among them, with weaker moves
+// getting more likely the lower the level. The result is the one of the
+// search, with the move played and its score.
+func (sk Skill) Search(ctx context.Context, game *Game, limits SearchLimits, rnd *rand.Rand, onIteration func(SearchResult)) SearchResult {
+	sk = sk.clamp()
+	if sk == MaxSkill {
+		return SearchContext(ctx, game, limits, onIteration)
+	}
+	best, moves := search(ctx, game, sk.Limit(limits), skillCandidates, onIteration)
+	if len(moves) == 0 {
+		return best
+	}
+	m := sk.pick(moves, rnd)
+	if m.move == moves[0].move {
+		return best
+	}
+	move := game.BitPosition().toMove(game.board, m.move, nil)
+	best.Move, best.PV = move, []Move{move}
+	best.Score, best.Mate = m.score, mateIn(m.score)
+	return best
+}
+
+// pick chooses the move to play from moves, sorted best first. Sometimes
+// it makes a deliberate inaccuracy: a random move that loses up to a few
+// pawns. Otherwise it adds a random bonus to the scores of the best moves
+// that grows with the weakness of the level and with how much worse a
+// move is, and plays the move with the highest sum.
+func (sk Skill) pick(moves []scoredMove, rnd *rand.Rand) scoredMove {
+	weakness := int(MaxSkill - sk)
+	top := moves[0].score
+	if rnd.Intn(100) < 2*weakness {
+		margin := 20 * weakness
+		n := 0
+		for n < len(moves) && moves[n].score >= top-margin {
+			n++
+		}
+		return moves[rnd.Intn(n)]
+	}
+
+	candidates := moves[:min(len(moves), skillCandidates)]
+	spread := 120 - 2*int(sk)
+	delta := min(top-candidates[len(candidates)-1].score, getPieceValue(Pawn))
+	best, bestScore := candidates[0], -infinity
+	for _, m := range candidates {
+		push := (spread*(top-m.score) + delta*rnd.Intn(spread)) / 128
+		if m.score+push > bestScore {
+			best, bestScore = m, m.score+push
+		}
+	}
+	return best
+}
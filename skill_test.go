@@ -0,0 +1,90 @@
+package chess
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSkillElo(t *testing.T) {
+	for sk := Skill(0); sk <= MaxSkill; sk++ {
+		if got := SkillForElo(sk.Elo()); got != sk {
+			t.Errorf("skill %d: SkillForElo(%d) = %d", sk, sk.Elo(), got)
+		}
+	}
+	if SkillForElo(0) != 0 || SkillForElo(4000) != MaxSkill {
+		t.Error("ratings out of range are not clamped")
+	}
+}
+
+func TestSkillEloMonotonic(t *testing.T) {
+	for sk := Skill(-2); sk <= MaxSkill+2; sk++ {
+		elo := sk.Elo()
+		if elo < MinElo || elo > MaxElo {
+			t.Errorf("skill %d: Elo %d out of [%d, %d]", sk, elo, MinElo, MaxElo)
+		}
+		if sk > 0 && sk <= MaxSkill && elo <= (sk-1).Elo() {
+			t.Errorf("skill %d: Elo %d not above the one of skill %d", sk, elo, sk-1)
+		}
+	}
+	prev := Skill(0)
+	for elo := MinElo - 500; elo <= MaxElo+500; elo += 10 {
+		sk := SkillForElo(elo)
+		if sk < prev || sk > MaxSkill {
+			t.Errorf("SkillForElo(%d) = %d after %d", elo, sk, prev)
+		}
+		prev = sk
+	}
+}
+
+// TestSkillLimit checks that a search limited by time only, as the one of
+// cmd/chess, gets deeper with the skill level and is not cut at MaxSkill.
+func TestSkillLimit(t *testing.T) {
+	limits := SearchLimits{MoveTime: 2 * time.Second}
+	prev := 0
+	for sk := Skill(0); sk < MaxSkill; sk++ {
+		l := sk.Limit(limits)
+		if l.Depth < prev || l.Depth == 0 || l.Nodes == 0 || l.MoveTime != limits.MoveTime {
+			t.Errorf("skill %d: got limits %+v after depth %d", sk, l, prev)
+		}
+		prev = l.Depth
+	}
+	if prev <= Skill(0).Limit(limits).Depth {
+		t.Errorf("depth %d at skill %d is not above the one of skill 0", prev, MaxSkill-1)
+	}
+	if l := MaxSkill.Limit(limits); l != limits {
+		t.Errorf("MaxSkill: got limits %+v, want %+v", l, limits)
+	}
+}
+
+func TestSkillSearch(t *testing.T) {
+	game, err := ParseFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := SearchLimits{Depth: 3}
+	rnd := rand.New(rand.NewSource(1))
+
+	want := Search(game, limits, nil)
+	got := MaxSkill.Search(context.Background(), game, limits, rnd, nil)
+	if got.Move.UCI() != want.Move.UCI() {
+		t.Errorf("full strength played %s, want %s", got.Move.UCI(), want.Move.UCI())
+	}
+
+	legal := map[string]bool{}
+	for _, m := range GenerateLegalMoves(game) {
+		legal[m.UCI()] = true
+	}
+	played := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		r := Skill(0).Search(context.Background(), game, limits, rnd, nil)
+		if !legal[r.Move.UCI()] {
+			t.Fatalf("illegal move %s", r.Move.UCI())
+		}
+		played[r.Move.UCI()] = true
+	}
+	if len(played) < 2 {
+		t.Error("skill 0 always plays the same move")
+	}
+}
@@ -0,0 +1,1157 @@
+package chess
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Syzygy endgame tablebases. A table like KRvK.rtbw stores for every
+// position of its material whether it is won, drawn or lost (WDL), the
+// matching KRvK.rtbz the distance to the next capture or pawn move that
+// keeps the result (DTZ). The file format is the one of Ronald de Man's
+// generator; this reader is written from the layout of the files, which
+// the comments below describe, and not ported from another prober.
+
+// WDL is the tablebase value of a position for the side to move. Cursed
+// wins and blessed losses are wins and losses that the 50-move rule turns
+// into draws.
+type WDL int
+
+const (
+	WDLLoss WDL = iota - 2
+	WDLBlessedLoss
+	WDLDraw
+	WDLCursedWin
+	WDLWin
+)
+
+// tbMaxPieces is the largest number of pieces Syzygy tables exist for.
+const tbMaxPieces = 7
+
+// tbWinScore is the search score of a position the tablebases prove won.
+// It is beyond any evaluation but below the mate scores.
+const tbWinScore = 20000
+
+var (
+	wdlMagic = [4]byte{0x71, 0xE8, 0x23, 0x5D}
+	dtzMagic = [4]byte{0xD7, 0x66, 0x0C, 0xA5}
+)
+
+// Flags of a file, in the byte after the magic number.
+const (
+	tbBothSides = 1 // the material is not symmetric, so WDL files have both sides to move
+	tbPawns     = 2
+)
+
+// Flags of a part of a file.
+const (
+	tbDTZBlack     = 1   // DTZ: the part has Black to move rather than White
+	tbDTZMapped    = 2   // DTZ: the values index the value maps of the part
+	tbDTZWinPlies  = 4   // DTZ: wins are counted in plies rather than moves
+	tbDTZLossPlies = 8   // DTZ: losses are counted in plies rather than moves
+	tbDTZWideMap   = 16  // DTZ: the value maps have 16 bit entries
+	tbConstant     = 128 // all positions of the part have the same value
+)
+
+// tbLeaf marks a symbol that is a value rather than a pair of symbols.
+const tbLeaf = 0xFFF
+
+// Syzygy is a set of Syzygy tablebase files. Files are read on first use.
+type Syzygy struct {
+	tables    map[string]*tbEntry // by material, e.g. "KRvK"
+	maxPieces int
+}
+
+type tbEntry struct {
+	wdl, dtz *tbFile
+}
+
+// tbFile is a WDL or DTZ file. The side named first in its name is called
+// white, whatever its color in a position.
+type tbFile struct {
+	path       string
+	isDTZ      bool
+	pieces     int
+	pawns      bool
+	bothPawns  bool // both sides have pawns
+	kingsFirst bool // no piece besides the kings is unique
+	symmetric  bool // both sides have the same material
+
+	once  sync.Once
+	err   error
+	data  []byte
+	parts [4][2]*tbPart // by file of the leading pawn, a to d, and side to move
+}
+
+// tbPart is the compressed table of one side to move and, with pawns, one
+// file of the leading pawn. The positions are numbered by the squares of
+// their pieces, see index. The values are coded as symbols of a canonical
+// Huffman code, each symbol standing for a value or for a pair of symbols,
+// and the codes fill blocks of a fixed size.
+type tbPart struct {
+	codes  [tbMaxPieces]int // the pieces in index order, see tbPieceCode
+	groups []tbGroup
+	size   uint64 // number of indices
+
+	flags    byte
+	constant int // the value of all positions, with tbConstant
+
+	// The lowest code of each length from minLen on, left aligned in 64
+	// bits, and the symbol it stands for.
+	minLen   int
+	lowest   []uint64
+	firstSym []int
+	symbols  []tbSymbol
+
+	spanBits   uint // the sparse index has an entry every 1<<spanBits values
+	blockBits  uint // a block has 1<<blockBits bytes
+	blocks     int  // number of blocks with a value count
+	dataBlocks int  // number of blocks stored
+
+	// Offsets into the file.
+	sparseIndex int
+	blockCounts int
+	blockData   int
+	dtzMaps     [4]int // of wins, losses, cursed wins and blessed losses
+}
+
+// tbSymbol is a value or a pair of symbols.
+type tbSymbol struct {
+	left, right int // the value and tbLeaf, or two symbols
+	length      int // number of values
+}
+
+// tbGroup is a group of pieces whose squares are numbered together: the
+// leading group of a part, or pieces of one kind.
+type tbGroup struct {
+	start, n int
+	pawns    bool   // the pawns of the side that does not lead
+	factor   uint64 // of the number of the group in the index
+}
+
+var syzygy *Syzygy
+
+// SetSyzygyPath loads the Syzygy tables of a list of directories, separated
+// like in the PATH environment variable, for the search: positions in the
+// tablebases are played perfectly, and positions the search reaches after
+// a capture or pawn move are scored by the tables. An empty path disables
+// the tablebases. The tables are replaced once running searches have ended.
+func SetSyzygyPath(path string) error {
+	var tb *Syzygy
+	if path != "" {
+		var err error
+		if tb, err = OpenSyzygy(path); err != nil {
+			return err
+		}
+	}
+	settings.Lock()
+	defer settings.Unlock()
+	syzygy = tb
+	return nil
+}
+
+// OpenSyzygy finds the Syzygy tables in a list of directories, separated
+// like in the PATH environment variable. Only the WDL files are looked for;
+// a missing DTZ file makes DTZ probes of its material fail.
+func OpenSyzygy(path string) (*Syzygy, error) {
+	tb := &Syzygy{tables: make(map[string]*tbEntry)}
+	for _, dir := range filepath.SplitList(path) {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), ".rtbw")
+			if name == f.Name() || tb.tables[name] != nil {
+				continue
+			}
+			wdl, err := newTBFile(name, filepath.Join(dir, f.Name()))
+			if err != nil {
+				continue
+			}
+			dtz, _ := newTBFile(name, filepath.Join(dir, name+".rtbz"))
+			dtz.isDTZ = true
+			tb.tables[name] = &tbEntry{wdl: wdl, dtz: dtz}
+			tb.maxPieces = max(tb.maxPieces, wdl.pieces)
+		}
+	}
+	if len(tb.tables) == 0 {
+		return nil, fmt.Errorf("no Syzygy tables found in %s", path)
+	}
+	return tb, nil
+}
+
+// Tables returns the number of tables found.
+func (tb *Syzygy) Tables() int {
+	return len(tb.tables)
+}
+
+// MaxPieces returns the number of pieces of the largest tables found.
+func (tb *Syzygy) MaxPieces() int {
+	return tb.maxPieces
+}
+
+// newTBFile checks a material name like KRPvKR and derives the properties
+// of its files from it.
+func newTBFile(name, path string) (*tbFile, error) {
+	sides := strings.Split(name, "v")
+	if len(sides) != 2 {
+		return nil, fmt.Errorf("invalid table name %q", name)
+	}
+	var count [2][6]int
+	for color, side := range sides {
+		for _, r := range side {
+			pt := strings.IndexRune("KQRBNP", r)
+			if pt < 0 {
+				return nil, fmt.Errorf("invalid table name %q", name)
+			}
+			count[color][pt]++
+		}
+		if count[color][King] != 1 || side[0] != 'K' {
+			return nil, fmt.Errorf("invalid table name %q", name)
+		}
+	}
+	f := &tbFile{
+		path:       path,
+		pieces:     len(sides[0]) + len(sides[1]),
+		pawns:      count[0][Pawn]+count[1][Pawn] > 0,
+		bothPawns:  count[0][Pawn] > 0 && count[1][Pawn] > 0,
+		kingsFirst: true,
+		symmetric:  sides[0] == sides[1],
+	}
+	if f.pieces > tbMaxPieces {
+		return nil, fmt.Errorf("too many pieces in table %q", name)
+	}
+	for color := range count {
+		for pt := Queen; pt <= Pawn; pt++ {
+			if count[color][pt] == 1 {
+				f.kingsFirst = false
+			}
+		}
+	}
+	return f, nil
+}
+
+// Squares are numbered as in the files below: a1 is 0, h8 is 63.
+var (
+	tbTriangle  [64]int     // a1-d1-d4: b1, c1, d1, c2, d2, d3, then a1, b2, c3, d4
+	tbBelow     [64]int     // the squares below the a1-h8 diagonal: b1 to h1, c2 to h2, ...
+	tbKings     [10][64]int // by the tbTriangle of one king and the square of the other
+	tbPawnOrder [64]int     // the pawn squares from 47 down: a2, h2, a3, h3, ..., b2, g2, ...
+	tbLeadIndex [6][64]int  // by the number of leading pawns and the square of the first
+	tbLeadCount [6][4]int   // by the number of leading pawns and the file of the first
+	choose      [7][64]uint64
+)
+
+// tbDiagonal is positive above the a1-h8 diagonal and negative below it.
+func tbDiagonal(sq int) int {
+	return sq/8 - sq%8
+}
+
+func init() {
+	for n := 0; n < 64; n++ {
+		choose[0][n] = 1
+		for k := 1; k < len(choose) && k <= n; k++ {
+			choose[k][n] = choose[k-1][n-1] + choose[k][n-1]
+		}
+	}
+
+	var triangle [10]int
+	below, offDiagonal, onDiagonal := 0, 0, 6
+	for sq := 0; sq < 64; sq++ {
+		switch d := tbDiagonal(sq); {
+		case d < 0:
+			tbBelow[sq] = below
+			below++
+			if sq%8 <= 3 {
+				tbTriangle[sq] = offDiagonal
+				triangle[offDiagonal] = sq
+				offDiagonal++
+			}
+		case d == 0 && sq%8 <= 3:
+			tbTriangle[sq] = onDiagonal
+			triangle[onDiagonal] = sq
+			onDiagonal++
+		}
+	}
+
+	// The kings may not touch, and with the first one on the diagonal the
+	// other one is not above it. The placements with both kings on the
+	// diagonal are numbered last.
+	n := 0
+	var bothOnDiagonal [][2]int
+	for t, k1 := range triangle {
+		for k2 := 0; k2 < 64; k2++ {
+			switch {
+			case max(abs(k1/8-k2/8), abs(k1%8-k2%8)) <= 1:
+			case tbDiagonal(k1) != 0 || tbDiagonal(k2) < 0:
+				tbKings[t][k2] = n
+				n++
+			case tbDiagonal(k2) == 0:
+				bothOnDiagonal = append(bothOnDiagonal, [2]int{t, k2})
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		tbKings[p[0]][p[1]] = n
+		n++
+	}
+
+	// Pawns nearer the edge, and on the same file the ones on lower
+	// ranks, come first. The leading pawn is the highest of its group;
+	// the others choose their squares from the ones below it.
+	for sq := 8; sq < 56; sq++ {
+		file := sq % 8
+		tbPawnOrder[sq] = 47 - 12*min(file, 7-file) - 2*(sq/8-1)
+		if file > 3 {
+			tbPawnOrder[sq]--
+		}
+	}
+	for lead := 1; lead < len(tbLeadIndex); lead++ {
+		for file := 0; file < 4; file++ {
+			n := 0
+			for sq := 8 + file; sq < 56; sq += 8 {
+				tbLeadIndex[lead][sq] = n
+				n += int(choose[lead-1][tbPawnOrder[sq]])
+			}
+			tbLeadCount[lead][file] = n
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// tbReader reads the fields of a file from the front.
+type tbReader struct {
+	data []byte
+	off  int
+}
+
+func (r *tbReader) u8() int {
+	r.off++
+	return int(r.data[r.off-1])
+}
+
+func (r *tbReader) u16() int {
+	r.off += 2
+	return int(binary.LittleEndian.Uint16(r.data[r.off-2:]))
+}
+
+func (r *tbReader) u32() int {
+	r.off += 4
+	return int(binary.LittleEndian.Uint32(r.data[r.off-4:]))
+}
+
+// skip passes over n bytes and returns the offset of the first.
+func (r *tbReader) skip(n int) int {
+	r.off += n
+	return r.off - n
+}
+
+func (r *tbReader) align(n int) {
+	r.off = (r.off + n - 1) / n * n
+}
+
+// load reads the file on first use.
+func (f *tbFile) load() error {
+	f.once.Do(func() {
+		data, err := os.ReadFile(f.path)
+		if err == nil {
+			err = f.parse(data)
+		}
+		f.err = err
+	})
+	return f.err
+}
+
+// parse reads the layout of a file:
+//
+//	the magic number, 4 bytes
+//	the flags tbBothSides and tbPawns
+//	per file of the leading pawn, just one without pawns:
+//	    the place of the leading group among the factors of the index
+//	    with pawns on both sides, the place of the pawns that do not lead
+//	    the pieces in index order, a byte each
+//	padding to an even offset
+//	the header of each part, see readCode
+//	DTZ only: the value maps of the parts, see readMaps
+//	the sparse index of each part, 6 bytes per entry
+//	the value counts of the blocks of each part, 2 bytes per block
+//	the blocks of each part, from an offset divisible by 64
+//
+// The bytes before the headers of the parts describe the part with White
+// to move in their low nibbles, Black to move in the high nibbles. The
+// parts follow each other by file, then side to move.
+func (f *tbFile) parse(data []byte) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("%s is corrupted", f.path)
+		}
+	}()
+	magic := wdlMagic
+	if f.isDTZ {
+		magic = dtzMagic
+	}
+	if len(data) < 5 || [4]byte(data[:4]) != magic {
+		return fmt.Errorf("%s is not a Syzygy table", f.path)
+	}
+	if (data[4]&tbPawns != 0) != f.pawns || (data[4]&tbBothSides != 0) == f.symmetric {
+		return fmt.Errorf("%s does not match its name", f.path)
+	}
+
+	r := &tbReader{data: data, off: 5}
+	files, sides := 1, 2
+	if f.pawns {
+		files = 4
+	}
+	if f.isDTZ || f.symmetric {
+		sides = 1
+	}
+	var parts []*tbPart
+	for file := 0; file < files; file++ {
+		order, otherOrder := r.u8(), 0xFF
+		if f.bothPawns {
+			otherOrder = r.u8()
+		}
+		codes := data[r.skip(f.pieces):r.off]
+		for side := 0; side < sides; side++ {
+			shift := 4 * side
+			p := &tbPart{}
+			for i, c := range codes {
+				p.codes[i] = int(c>>shift) & 0xF
+			}
+			p.setGroups(f, file, order>>shift&0xF, otherOrder>>shift&0xF)
+			f.parts[file][side] = p
+			parts = append(parts, p)
+		}
+	}
+	r.align(2)
+	for _, p := range parts {
+		p.readCode(r)
+	}
+	if f.isDTZ {
+		readMaps(r, parts)
+	}
+	for _, p := range parts {
+		p.sparseIndex = r.skip(6 * p.sparseEntries())
+	}
+	for _, p := range parts {
+		p.blockCounts = r.skip(2 * p.blocks)
+	}
+	for _, p := range parts {
+		r.align(64)
+		p.blockData = r.skip(p.dataBlocks << p.blockBits)
+	}
+	if r.off > len(data) {
+		return fmt.Errorf("%s is truncated", f.path)
+	}
+	// Decoding reads a few bytes ahead.
+	f.data = append(data, make([]byte, 8)...)
+	return nil
+}
+
+// setGroups divides the pieces of a part into the groups of its index and
+// computes their factors. The leading group is first: the leading pawns,
+// else the kings if no other piece is unique, else three unique pieces.
+// With pawns on both sides the pawns of the other side follow, then each
+// kind of piece. The factors follow the order of the groups, except that
+// order and otherOrder tell where those of the leading group and of the
+// pawns of the other side go.
+func (p *tbPart) setGroups(f *tbFile, file, order, otherOrder int) {
+	lead := 3
+	switch {
+	case f.pawns:
+		lead = p.run(0, f.pieces)
+	case f.kingsFirst:
+		lead = 2
+	}
+	p.groups = []tbGroup{{start: 0, n: lead}}
+	for i := lead; i < f.pieces; {
+		g := tbGroup{start: i, n: p.run(i, f.pieces), pawns: i == lead && f.bothPawns}
+		p.groups = append(p.groups, g)
+		i += g.n
+	}
+
+	var placements uint64
+	switch {
+	case f.pawns:
+		placements = uint64(tbLeadCount[lead][file])
+	case f.kingsFirst:
+		placements = 462
+	default:
+		placements = 31332
+	}
+	size, free, next := uint64(1), 64-lead, 1
+	if f.bothPawns {
+		free -= p.groups[1].n
+		next = 2
+	}
+	for place := 0; next < len(p.groups) || place == order || place == otherOrder; place++ {
+		switch place {
+		case order:
+			p.groups[0].factor = size
+			size *= placements
+		case otherOrder:
+			p.groups[1].factor = size
+			size *= choose[p.groups[1].n][48-lead]
+		default:
+			g := &p.groups[next]
+			g.factor = size
+			size *= choose[g.n][free]
+			free -= g.n
+			next++
+		}
+	}
+	p.size = size
+}
+
+// run returns the number of equal pieces from the i-th one on.
+func (p *tbPart) run(i, pieces int) int {
+	n := 1
+	for i+n < pieces && p.codes[i+n] == p.codes[i] {
+		n++
+	}
+	return n
+}
+
+// readCode reads the header of a part:
+//
+//	the flags
+//	with tbConstant, the value and nothing else
+//	the log2 of the bytes of a block
+//	the log2 of the number of values between entries of the sparse index
+//	the number of blocks with a value count but no data
+//	the number of blocks with data, 4 bytes
+//	the lengths of the longest and the shortest code
+//	per code length, shortest first: its first symbol, 2 bytes
+//	the number of symbols, 2 bytes
+//	per symbol, 3 bytes: its left and its right half, 12 bits each, the
+//	    left one in the low bits; the right half of a value is tbLeaf
+//	padding to an even number of symbols
+//
+// Codes of the same length are consecutive numbers, and a shorter code is
+// higher than the longer codes it does not prefix.
+func (p *tbPart) readCode(r *tbReader) {
+	p.flags = byte(r.u8())
+	if p.flags&tbConstant != 0 {
+		p.constant = r.u8()
+		return
+	}
+	p.blockBits = uint(r.u8())
+	p.spanBits = uint(r.u8())
+	countOnly := r.u8()
+	p.dataBlocks = r.u32()
+	p.blocks = p.dataBlocks + countOnly
+	maxLen := r.u8()
+	p.minLen = r.u8()
+	p.firstSym = make([]int, maxLen-p.minLen+1)
+	for i := range p.firstSym {
+		p.firstSym[i] = r.u16()
+	}
+	// The symbols of longer codes come first, so the first symbols tell
+	// the number of codes of each length.
+	p.lowest = make([]uint64, len(p.firstSym))
+	for i := len(p.lowest) - 2; i >= 0; i-- {
+		p.lowest[i] = (p.lowest[i+1] + uint64(p.firstSym[i]-p.firstSym[i+1])) / 2
+	}
+	for i := range p.lowest {
+		p.lowest[i] <<= 64 - uint(p.minLen+i)
+	}
+
+	p.symbols = make([]tbSymbol, r.u16())
+	for i := range p.symbols {
+		b := r.data[r.skip(3):]
+		p.symbols[i] = tbSymbol{left: int(b[1]&0xF)<<8 | int(b[0]), right: int(b[2])<<4 | int(b[1]>>4)}
+	}
+	r.skip(len(p.symbols) & 1)
+	for i := range p.symbols {
+		p.symbolLength(i)
+	}
+}
+
+// symbolLength returns the number of values a symbol stands for.
+func (p *tbPart) symbolLength(sym int) int {
+	s := &p.symbols[sym]
+	switch {
+	case s.length > 0:
+	case s.length < 0:
+		panic("cyclic symbol")
+	case s.right == tbLeaf:
+		s.length = 1
+	default:
+		s.length = -1
+		s.length = p.symbolLength(s.left) + p.symbolLength(s.right)
+	}
+	return s.length
+}
+
+// sparseEntries returns the number of entries of the sparse index.
+func (p *tbPart) sparseEntries() int {
+	if p.flags&tbConstant != 0 {
+		return 0
+	}
+	return int((p.size + 1<<p.spanBits - 1) >> p.spanBits)
+}
+
+// readMaps reads the value maps of the DTZ parts that have them. A part
+// has four, of wins, losses, cursed wins and blessed losses, each a count
+// and that many values, bytes or, with tbDTZWideMap, 2 byte words from an
+// even offset. The maps end at an even offset.
+func readMaps(r *tbReader, parts []*tbPart) {
+	for _, p := range parts {
+		if p.flags&tbDTZMapped == 0 {
+			continue
+		}
+		if p.flags&tbDTZWideMap != 0 {
+			r.align(2)
+			for i := range p.dtzMaps {
+				n := r.u16()
+				p.dtzMaps[i] = r.skip(2 * n)
+			}
+		} else {
+			for i := range p.dtzMaps {
+				n := r.u8()
+				p.dtzMaps[i] = r.skip(n)
+			}
+		}
+	}
+	r.align(2)
+}
+
+// tbBits reads the codes of a block, highest bit first.
+type tbBits struct {
+	data []byte
+	off  int
+	buf  uint64 // the next bits, left aligned
+	n    uint   // number of bits in buf
+}
+
+func (b *tbBits) fill() {
+	for b.n <= 56 {
+		b.buf |= uint64(b.data[b.off]) << (56 - b.n)
+		b.off++
+		b.n += 8
+	}
+}
+
+// readSymbol decodes the next symbol of a block.
+func (p *tbPart) readSymbol(b *tbBits) int {
+	i := 0
+	for b.buf < p.lowest[i] {
+		i++
+	}
+	l := uint(p.minLen + i)
+	sym := p.firstSym[i] + int((b.buf-p.lowest[i])>>(64-l))
+	b.buf <<= l
+	b.n -= l
+	b.fill()
+	return sym
+}
+
+// value returns the value at an index of the part.
+func (p *tbPart) value(data []byte, idx uint64) int {
+	if p.flags&tbConstant != 0 {
+		return p.constant
+	}
+
+	// An entry of the sparse index gives the block of the middle value of
+	// its span and the place of the value there, 4 and 2 bytes. The value
+	// counts of the blocks, less one, lead from there to idx.
+	entry := p.sparseIndex + 6*int(idx>>p.spanBits)
+	block := int(binary.LittleEndian.Uint32(data[entry:]))
+	k := int(binary.LittleEndian.Uint16(data[entry+4:])) + int(idx&(1<<p.spanBits-1)) - 1<<p.spanBits/2
+	count := func(block int) int {
+		return int(binary.LittleEndian.Uint16(data[p.blockCounts+2*block:])) + 1
+	}
+	for k < 0 {
+		block--
+		k += count(block)
+	}
+	for k >= count(block) {
+		k -= count(block)
+		block++
+	}
+
+	// Skip the symbols before the one with the value, then follow the
+	// pairs down to it.
+	bits := &tbBits{data: data, off: p.blockData + block<<p.blockBits}
+	bits.fill()
+	sym := p.readSymbol(bits)
+	for k >= p.symbols[sym].length {
+		k -= p.symbols[sym].length
+		sym = p.readSymbol(bits)
+	}
+	for s := p.symbols[sym]; s.right != tbLeaf; s = p.symbols[sym] {
+		if n := p.symbols[s.left].length; k < n {
+			sym = s.left
+		} else {
+			k -= n
+			sym = s.right
+		}
+	}
+	return p.symbols[sym].left
+}
+
+// tbPieceCode is the code of a white piece in the files; black adds 8.
+var tbPieceCode = [6]int{King: 6, Queen: 5, Rook: 4, Bishop: 3, Knight: 2, Pawn: 1}
+
+// tbPieceType is the inverse of tbPieceCode.
+var tbPieceType = [7]PieceType{1: Pawn, 2: Knight, 3: Bishop, 4: Rook, 5: Queen, 6: King}
+
+// material returns the pieces of one color as in table names, e.g. KRP.
+func (p *BitPosition) material(color Color) string {
+	var sb strings.Builder
+	for pt := King; pt <= Pawn; pt++ {
+		for i := p.pieces[color][pt].count(); i > 0; i-- {
+			sb.WriteByte("KQRBNP"[pt])
+		}
+	}
+	return sb.String()
+}
+
+// part returns the part of the file a position of its material is in, and
+// the side to move in the file. With swap the colors are swapped, so that
+// white of the file is Black, and the board is mirrored. The part of a DTZ
+// file may have the other side to move.
+func (f *tbFile) part(pos *BitPosition, swap bool) (p *tbPart, stm int) {
+	stm = int(pos.turn)
+	if swap {
+		stm ^= 1
+	}
+	file := 0
+	if f.pawns {
+		sq := f.squares(pos, f.parts[0][0], swap)
+		file = min(sq[0]%8, 7-sq[0]%8)
+	}
+	if f.isDTZ {
+		return f.parts[file][0], stm
+	}
+	return f.parts[file][stm], stm
+}
+
+// squares returns the squares of the pieces of a position in the order of
+// a part, the leading pawn first.
+func (f *tbFile) squares(pos *BitPosition, p *tbPart, swap bool) []int {
+	mirror := 56
+	if swap {
+		mirror = 0
+	}
+	sq := make([]int, f.pieces)
+	var taken Bitboard
+	for i := range sq {
+		color := Color(p.codes[i] >> 3)
+		if swap {
+			color = opposite(color)
+		}
+		s := (pos.pieces[color][tbPieceType[p.codes[i]&7]] &^ taken).lsb()
+		taken |= squareBB(s)
+		sq[i] = s ^ mirror
+		if f.pawns && p.codes[i] == p.codes[0] && tbPawnOrder[sq[i]] > tbPawnOrder[sq[0]] {
+			sq[0], sq[i] = sq[i], sq[0]
+		}
+	}
+	return sq
+}
+
+// index returns the number of a position in the part, given the squares
+// of its pieces. The leading group is numbered up to the symmetries of the
+// board: its first piece is moved to the files a to d, without pawns to the
+// a1-d1-d4 triangle, where the first piece of the group that is off the
+// a1-h8 diagonal goes below it. The other groups choose their squares from
+// the ones left, pawns from the ranks 2 to 7.
+func (p *tbPart) index(f *tbFile, sq []int) uint64 {
+	lead := p.groups[0].n
+	if sq[0]%8 > 3 {
+		for i := range sq {
+			sq[i] ^= 7
+		}
+	}
+	var idx uint64
+	if f.pawns {
+		others := sq[1:lead]
+		sortInts(others, func(a, b int) bool { return tbPawnOrder[a] < tbPawnOrder[b] })
+		idx = uint64(tbLeadIndex[lead][sq[0]])
+		for i, s := range others {
+			idx += choose[i+1][tbPawnOrder[s]]
+		}
+	} else {
+		if sq[0]/8 > 3 {
+			for i := range sq {
+				sq[i] ^= 56
+			}
+		}
+		for _, s := range sq[:lead] {
+			if d := tbDiagonal(s); d != 0 {
+				if d > 0 {
+					for i := range sq {
+						sq[i] = sq[i]>>3 | sq[i]&7<<3
+					}
+				}
+				break
+			}
+		}
+		if f.kingsFirst {
+			idx = uint64(tbKings[tbTriangle[sq[0]]][sq[1]])
+		} else {
+			idx = tbUniqueIndex(sq[0], sq[1], sq[2])
+		}
+	}
+	idx *= p.groups[0].factor
+
+	for _, g := range p.groups[1:] {
+		squares := sq[g.start : g.start+g.n]
+		sortInts(squares, func(a, b int) bool { return a < b })
+		var n uint64
+		for i, s := range squares {
+			free := s
+			for _, t := range sq[:g.start] {
+				if t < s {
+					free--
+				}
+			}
+			if g.pawns {
+				free -= 8
+			}
+			n += choose[i+1][free]
+		}
+		idx += n * g.factor
+	}
+	return idx
+}
+
+// tbUniqueIndex numbers the squares of three unique leading pieces: first
+// the ones with the first piece off the diagonal, then with the second, the
+// third and none off it. Each piece skips the squares of the ones before.
+func tbUniqueIndex(a, b, c int) uint64 {
+	const (
+		firstOff  = 6 * 63 * 62
+		secondOff = 4 * 28 * 62
+		thirdOff  = 4 * 7 * 28
+	)
+	skipB, skipC := 0, 0
+	if b > a {
+		skipB++
+	}
+	if c > a {
+		skipC++
+	}
+	if c > b {
+		skipC++
+	}
+	switch {
+	case tbDiagonal(a) != 0:
+		return uint64((tbTriangle[a]*63+b-skipB)*62 + c - skipC)
+	case tbDiagonal(b) != 0:
+		return firstOff + uint64((a/8*28+tbBelow[b])*62+c-skipC)
+	case tbDiagonal(c) != 0:
+		return firstOff + secondOff + uint64((a/8*7+b/8-skipB)*28+tbBelow[c])
+	}
+	return firstOff + secondOff + thirdOff + uint64((a/8*7+b/8-skipB)*6+c/8-skipC)
+}
+
+// sortInts is an insertion sort for the few squares of a group.
+func sortInts(s []int, less func(a, b int) bool) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && less(s[j], s[j-1]); j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
+
+// dtzPlies converts a value of a DTZ part into the plies to the next
+// capture or pawn move, given the WDL value of the position.
+func (f *tbFile) dtzPlies(p *tbPart, v int, wdl WDL) int {
+	if p.flags&tbDTZMapped != 0 {
+		m := p.dtzMaps[[5]int{1, 3, 0, 2, 0}[wdl+2]]
+		if p.flags&tbDTZWideMap != 0 {
+			v = int(binary.LittleEndian.Uint16(f.data[m+2*v:]))
+		} else {
+			v = int(f.data[m+v])
+		}
+	}
+	if (wdl != WDLWin || p.flags&tbDTZWinPlies == 0) && (wdl != WDLLoss || p.flags&tbDTZLossPlies == 0) {
+		v *= 2
+	}
+	return v + 1
+}
+
+// probe looks a position up in the WDL or the DTZ file of its material.
+// The value of a DTZ file depends on the WDL value of the position. other
+// tells that the DTZ file only has the other side to move.
+func (tb *Syzygy) probe(pos *BitPosition, dtz bool, wdl WDL) (value int, other, ok bool) {
+	if pos.occupied.count() == 2 {
+		return int(WDLDraw), false, true
+	}
+	white, black := pos.material(White), pos.material(Black)
+	e, swap := tb.tables[white+"v"+black], false
+	if e == nil {
+		e, swap = tb.tables[black+"v"+white], true
+	}
+	if e == nil {
+		return 0, false, false
+	}
+	f := e.wdl
+	if dtz {
+		f = e.dtz
+	}
+	if f.load() != nil {
+		return 0, false, false
+	}
+	// Symmetric materials are stored with White to move only.
+	if f.symmetric {
+		swap = pos.turn == Black
+	}
+	p, stm := f.part(pos, swap)
+	if f.isDTZ && int(p.flags&tbDTZBlack) != stm && (f.pawns || !f.symmetric) {
+		return 0, true, true
+	}
+	v := p.value(f.data, p.index(f, f.squares(pos, p, swap)))
+	if !dtz {
+		return v - 2, false, true
+	}
+	return f.dtzPlies(p, v, wdl), false, true
+}
+
+// isCapture tells whether a move captures, en passant included.
+func (p *BitPosition) isCapture(m bitMove) bool {
+	_, pt, _ := p.pieceAt(m.from())
+	return p.squares[m.to()] != noPiece || (pt == Pawn && m.from()%8 != m.to()%8)
+}
+
+// wdl returns the WDL value of a position. The files need not be right for
+// positions where a capture is the best move, or with zeroing a capture or
+// a pawn move, so these moves are tried too; zero tells that one of them is
+// the best move.
+func (tb *Syzygy) wdl(pos *BitPosition, zeroing bool) (value WDL, zero, ok bool) {
+	moves := pos.legalMoves()
+	best, tried := WDLLoss-1, 0
+	for _, m := range moves {
+		if !pos.isCapture(m) {
+			if _, pt, _ := pos.pieceAt(m.from()); !zeroing || pt != Pawn {
+				continue
+			}
+		}
+		tried++
+		child := *pos
+		child.makeMove(m)
+		v, _, ok := tb.wdl(&child, false)
+		if !ok {
+			return WDLDraw, false, false
+		}
+		if best = max(best, -v); best == WDLWin {
+			return best, true, true
+		}
+	}
+	// The files may hold anything for positions without other moves, like
+	// the ones where an en passant capture is the only move.
+	if tried > 0 && tried == len(moves) {
+		return best, true, true
+	}
+	v, _, ok := tb.probe(pos, false, 0)
+	if !ok {
+		return WDLDraw, false, false
+	}
+	if stored := WDL(v); best < stored {
+		return stored, false, true
+	}
+	return best, best > WDLDraw, true
+}
+
+// dtzBeforeZeroing returns the DTZ of a position whose best move is a
+// capture or pawn move.
+func dtzBeforeZeroing(wdl WDL) int {
+	return [5]int{-1, -101, 0, 101, 1}[wdl+2]
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+// dtz returns the DTZ of a position, see ProbeDTZ. A position whose side to
+// move is mated has a DTZ of -1.
+func (tb *Syzygy) dtz(pos *BitPosition) (int, bool) {
+	wdl, zero, ok := tb.wdl(pos, true)
+	switch {
+	case !ok:
+		return 0, false
+	case wdl == WDLDraw:
+		return 0, true
+	case zero:
+		return dtzBeforeZeroing(wdl), true
+	}
+	dtz, other, ok := tb.probe(pos, true, wdl)
+	switch {
+	case !ok:
+		return 0, false
+	case !other:
+		if wdl == WDLCursedWin || wdl == WDLBlessedLoss {
+			dtz += 100
+		}
+		return dtz * sign(int(wdl)), true
+	}
+
+	// The file only has the other side to move: the best move tells.
+	best := 0
+	for _, m := range pos.legalMoves() {
+		dtz, ok := tb.moveDTZ(pos, m)
+		if !ok {
+			return 0, false
+		}
+		if sign(dtz) == sign(int(wdl)) && (best == 0 || dtz < best) {
+			best = dtz
+		}
+	}
+	if best == 0 {
+		return -1, true
+	}
+	return best, true
+}
+
+// moveDTZ returns the DTZ of a position counted through one of its moves.
+func (tb *Syzygy) moveDTZ(pos *BitPosition, m bitMove) (int, bool) {
+	child := *pos
+	child.makeMove(m)
+	if child.halfmove == 0 {
+		wdl, _, ok := tb.wdl(&child, false)
+		return dtzBeforeZeroing(-wdl), ok
+	}
+	dtz, ok := tb.dtz(&child)
+	if dtz == -1 && child.inCheck(child.turn) && len(child.legalMoves()) == 0 {
+		return 1, ok
+	}
+	return -dtz - sign(dtz), ok
+}
+
+// canProbe tells whether the tables may have the position: without
+// castling rights and with few enough pieces.
+func (tb *Syzygy) canProbe(pos *BitPosition) bool {
+	return pos.castling == 0 && pos.occupied.count() <= tb.maxPieces
+}
+
+func (tb *Syzygy) probeWDL(pos *BitPosition) (WDL, bool) {
+	if !tb.canProbe(pos) {
+		return WDLDraw, false
+	}
+	wdl, _, ok := tb.wdl(pos, false)
+	return wdl, ok
+}
+
+func (tb *Syzygy) probeDTZ(pos *BitPosition) (int, bool) {
+	if !tb.canProbe(pos) {
+		return 0, false
+	}
+	return tb.dtz(pos)
+}
+
+// ProbeWDL returns the WDL value of the current position of the game.
+func (tb *Syzygy) ProbeWDL(game *Game) (WDL, error) {
+	wdl, ok := tb.probeWDL(game.BitPosition())
+	if !ok {
+		return WDLDraw, fmt.Errorf("position not in the tablebases")
+	}
+	return wdl, nil
+}
+
+// ProbeDTZ returns the distance in plies to the next capture or pawn move
+// that keeps the result of the current position of the game, see WDL:
+// positive if the side to move wins, negative if it loses, 100 more for
+// cursed wins and blessed losses, and 0 for draws.
+func (tb *Syzygy) ProbeDTZ(game *Game) (int, error) {
+	dtz, ok := tb.probeDTZ(game.BitPosition())
+	if !ok {
+		return 0, fmt.Errorf("position not in the tablebases")
+	}
+	return dtz, nil
+}
+
+// The moves of the root are ranked in classes, tbClass apart, from certain
+// losses to certain wins; tbClassScores are their search scores. Wins the
+// 50-move rule might spoil and losses it might save score like draws, only
+// just apart.
+const tbClass = 10000
+
+var tbClassScores = [5]int{-tbWinScore, -1, 0, 1, tbWinScore}
+
+// tbRank ranks a move by its DTZ, counted from before the move: certain
+// wins, the fastest first, then wins the 50-move rule might spoil, draws,
+// losses it might save, and certain losses, the slowest first. A win is
+// certain if it is reached before the 50-move rule and no position has
+// repeated that might be repeated again.
+func tbRank(dtz, halfmove int, repeated bool) int {
+	switch {
+	case dtz > 0 && dtz+halfmove <= 100 && !repeated:
+		return 5*tbClass - dtz
+	case dtz > 0:
+		return 4*tbClass - dtz
+	case dtz == 0:
+		return 2 * tbClass
+	case -dtz+halfmove > 100:
+		return tbClass - dtz
+	}
+	return -dtz
+}
+
+// rootMoves returns the moves of the game that keep the best tablebase
+// result, see tbRank, with the score of the position. Without the DTZ
+// file only the results count. ok is false if the position is not in the
+// tablebases.
+func (tb *Syzygy) rootMoves(game *Game) (moves []bitMove, score int, ok bool) {
+	if tb == nil {
+		return nil, 0, false
+	}
+	pos := game.BitPosition()
+	if !tb.canProbe(pos) {
+		return nil, 0, false
+	}
+	repeated := len(game.RepetitionPlies()) > 0
+	best := -1
+	for _, m := range pos.legalMoves() {
+		dtz, ok := tb.moveDTZ(pos, m)
+		if !ok {
+			return tb.rootMovesWDL(pos)
+		}
+		rank := tbRank(dtz, game.halfmoveClock, repeated)
+		if rank > best {
+			moves, best = moves[:0], rank
+		}
+		if rank == best {
+			moves = append(moves, m)
+		}
+	}
+	return moves, tbClassScores[max(best, 0)/tbClass], moves != nil
+}
+
+// rootMovesWDL is rootMoves for materials without a DTZ file.
+func (tb *Syzygy) rootMovesWDL(pos *BitPosition) (moves []bitMove, score int, ok bool) {
+	best := WDLLoss - 1
+	for _, m := range pos.legalMoves() {
+		child := *pos
+		child.makeMove(m)
+		wdl, _, ok := tb.wdl(&child, false)
+		if !ok {
+			return nil, 0, false
+		}
+		if -wdl > best {
+			moves, best = moves[:0], -wdl
+		}
+		if -wdl == best {
+			moves = append(moves, m)
+		}
+	}
+	return moves, tbClassScores[max(best, WDLLoss)+2], moves != nil
+}
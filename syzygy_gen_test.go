@@ -0,0 +1,616 @@
+package chess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The tables in testdata/syzygy are not the published ones: writeSyzygy
+// writes them in the same format, with the values of the DTM tables of
+// dtm.go. "go test -run TestSyzygyTestdata -update" writes them again.
+var updateSyzygy = flag.Bool("update", false, "rewrite the Syzygy tables in testdata")
+
+// syzygyTestTables are the materials of the tables in testdata/syzygy.
+// The DTZ file of KRvK has Black to move, so that the probes of the other
+// side search a ply. KBvK and KNvK are the draws after underpromotions.
+var syzygyTestTables = []struct {
+	name     string
+	dtzBlack bool
+}{
+	{"KQvK", false},
+	{"KRvK", true},
+	{"KPvK", false},
+	{"KBvK", false},
+	{"KNvK", false},
+}
+
+// Blocks and spans of the test tables are small, so that the values of a
+// span are spread over several blocks.
+const (
+	tbTestBlockBits = 5
+	tbTestSpanBits  = 7
+)
+
+// tbTruth holds the WDL and DTZ values of the positions of a material, by
+// key.
+type tbTruth struct {
+	t     *DTMTable
+	legal []bool
+	wdl   []WDL
+	dtz   []int
+}
+
+// key numbers a position by the squares of its pieces in the order of the
+// DTM table and the side to move.
+func (tt *tbTruth) key(pos *BitPosition) int {
+	k := 0
+	for _, pc := range tt.t.pieces {
+		k = k<<6 | pos.pieces[pc.color][pc.pt].lsb()
+	}
+	return k<<1 | int(pos.turn)
+}
+
+// position sets up the position of a key, or returns nil if it is illegal.
+func (tt *tbTruth) position(k int) *BitPosition {
+	var sq [dtmMaxPieces]int
+	var taken Bitboard
+	n := k >> 1
+	for i := len(tt.t.pieces) - 1; i >= 0; i-- {
+		sq[i] = n & 63
+		n >>= 6
+		if taken&squareBB(sq[i]) != 0 || tt.t.pieces[i].pt == Pawn && (sq[i] < 8 || sq[i] >= 56) {
+			return nil
+		}
+		taken |= squareBB(sq[i])
+	}
+	pos := tt.t.position(&sq, Color(k&1))
+	if pos.inCheck(opposite(pos.turn)) {
+		return nil
+	}
+	return pos
+}
+
+// newTBTruth computes the values of a material from the DTM tables of e,
+// which need to have it and the materials it converts to.
+func newTBTruth(e *Endgames, name string) (*tbTruth, error) {
+	t, err := newDTMTable(strings.Replace(name, "v", "", 1))
+	if err != nil {
+		return nil, err
+	}
+	n := 2 << (6 * len(t.pieces))
+	tt := &tbTruth{t: t, legal: make([]bool, n), wdl: make([]WDL, n), dtz: make([]int, n)}
+
+	// The moves of the decisive positions: to another key, or a capture, a
+	// pawn move or a mate, with its DTZ.
+	type edge struct{ key, dtz int }
+	edges := make([][]edge, n)
+	open := 0
+	for k := range tt.legal {
+		pos := tt.position(k)
+		if pos == nil {
+			continue
+		}
+		v, ok := e.value(pos)
+		if !ok {
+			return nil, fmt.Errorf("%s: no DTM table", name)
+		}
+		tt.legal[k] = true
+		if tt.wdl[k], _ = dtmResult(v); tt.wdl[k] == WDLDraw {
+			continue
+		}
+		open++
+		for _, m := range pos.legalMoves() {
+			child := *pos
+			child.makeMove(m)
+			switch {
+			case child.halfmove == 0:
+				v, _ := e.value(&child)
+				wdl, _ := dtmResult(v)
+				edges[k] = append(edges[k], edge{-1, dtzBeforeZeroing(-wdl)})
+			case child.inCheck(child.turn) && len(child.legalMoves()) == 0:
+				edges[k] = append(edges[k], edge{-1, 1})
+			default:
+				edges[k] = append(edges[k], edge{tt.key(&child), 0})
+			}
+		}
+	}
+
+	// A win is as far from zeroing as its nearest move into a loss, a loss
+	// as its farthest move. Both are found in the order of the distance.
+	for d := 1; open > 0; d++ {
+		if d > 200 {
+			return nil, fmt.Errorf("%s: DTZ of %d positions not found", name, open)
+		}
+		for k, wdl := range tt.wdl {
+			if wdl != WDLWin || tt.dtz[k] != 0 {
+				continue
+			}
+			best := 0
+			for _, m := range edges[k] {
+				dtz := m.dtz
+				if m.key >= 0 {
+					dtz = 0
+					if c := tt.dtz[m.key]; c < 0 {
+						dtz = 1 - c
+					}
+				}
+				if dtz > 0 && (best == 0 || dtz < best) {
+					best = dtz
+				}
+			}
+			if best == d {
+				tt.dtz[k] = d
+				open--
+			}
+		}
+		for k, wdl := range tt.wdl {
+			if wdl != WDLLoss || tt.dtz[k] != 0 {
+				continue
+			}
+			worst, known := -1, true
+			for _, m := range edges[k] {
+				dtz := m.dtz
+				if m.key >= 0 {
+					c := tt.dtz[m.key]
+					known = known && c > 0
+					dtz = -1 - c
+				}
+				worst = min(worst, dtz)
+			}
+			if known && worst == -d {
+				tt.dtz[k] = -d
+				open--
+			}
+		}
+	}
+	return tt, nil
+}
+
+// syzygyTestTruth returns the values of the materials of the test tables.
+var syzygyTestTruth = sync.OnceValues(func() (map[string]*tbTruth, error) {
+	e := NewEndgames()
+	for _, m := range []string{"KQK", "KRK", "KPK"} {
+		if _, err := e.Generate(m); err != nil {
+			return nil, err
+		}
+	}
+	truth := make(map[string]*tbTruth)
+	for _, tc := range syzygyTestTables {
+		tt, err := newTBTruth(e, tc.name)
+		if err != nil {
+			return nil, err
+		}
+		truth[tc.name] = tt
+	}
+	return truth, nil
+})
+
+// writeSyzygy returns the WDL or the DTZ file of the material of tt. The
+// DTZ file has Black to move with dtzBlack, and the leading group last
+// among the factors of its index.
+func writeSyzygy(tt *tbTruth, name string, dtz, dtzBlack bool) ([]byte, error) {
+	f, err := newTBFile(name, "")
+	if err != nil {
+		return nil, err
+	}
+	f.isDTZ = dtz
+	files, sides := 1, 2
+	if f.pawns {
+		files = 4
+	}
+	if dtz || f.symmetric {
+		sides = 1
+	}
+
+	// The pawns lead, the other pieces keep the order of the DTM table.
+	var codes []int
+	for _, pawns := range []bool{true, false} {
+		for _, pc := range tt.t.pieces {
+			if (pc.pt == Pawn) == pawns {
+				codes = append(codes, tbPieceCode[pc.pt]|int(pc.color)<<3)
+			}
+		}
+	}
+	var parts []*tbPart
+	orders := make([]int, files)
+	values := make(map[*tbPart][]int)
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			p := &tbPart{}
+			copy(p.codes[:], codes)
+			p.setGroups(f, file, 0, 0xF)
+			if dtz {
+				orders[file] = len(p.groups) - 1
+				p.setGroups(f, file, orders[file], 0xF)
+			}
+			f.parts[file][side] = p
+			parts = append(parts, p)
+			values[p] = make([]int, p.size)
+			for i := range values[p] {
+				values[p][i] = -1
+			}
+		}
+	}
+
+	// DTZ values are plies less one, twice that plus one for losses until
+	// they are mapped.
+	for k, legal := range tt.legal {
+		if !legal || dtz && tt.wdl[k] == WDLDraw {
+			continue
+		}
+		v := int(tt.wdl[k]) + 2
+		if dtz {
+			v = 2 * (abs(tt.dtz[k]) - 1)
+			if tt.wdl[k] == WDLLoss {
+				v++
+			}
+		}
+		pos := tt.position(k)
+		p, stm := f.part(pos, false)
+		if dtz && (stm == 1) != dtzBlack {
+			continue
+		}
+		idx := p.index(f, f.squares(pos, p, false))
+		if old := values[p][idx]; old >= 0 && old != v {
+			return nil, fmt.Errorf("%s: index %d has the values %d and %d", name, idx, old, v)
+		}
+		values[p][idx] = v
+	}
+
+	var maps [][4][]int
+	var encoded []tbEncodedPart
+	for _, p := range parts {
+		var flags byte
+		vs := values[p]
+		if dtz && hasValues(vs) {
+			flags = tbDTZMapped | tbDTZWinPlies | tbDTZLossPlies
+			if dtzBlack {
+				flags |= tbDTZBlack
+			}
+			var m [4][]int
+			for _, v := range vs {
+				if v >= 0 && !containsInt(m[v&1], v>>1) {
+					m[v&1] = append(m[v&1], v>>1)
+				}
+			}
+			sort.Ints(m[0])
+			sort.Ints(m[1])
+			for i, v := range vs {
+				if v >= 0 {
+					vs[i] = sort.SearchInts(m[v&1], v>>1)
+				}
+			}
+			maps = append(maps, m)
+		}
+		enc, err := encodePart(vs, flags)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		encoded = append(encoded, enc)
+	}
+
+	magic := wdlMagic
+	if dtz {
+		magic = dtzMagic
+	}
+	b := append([]byte{}, magic[:]...)
+	var flags byte
+	if !f.symmetric {
+		flags |= tbBothSides
+	}
+	if f.pawns {
+		flags |= tbPawns
+	}
+	b = append(b, flags)
+	for file := 0; file < files; file++ {
+		b = append(b, byte(orders[file]*0x11))
+		for _, c := range codes {
+			b = append(b, byte(c*0x11))
+		}
+	}
+	pad := func(n int) {
+		for len(b)%n != 0 {
+			b = append(b, 0)
+		}
+	}
+	pad(2)
+	for _, enc := range encoded {
+		b = append(b, enc.header...)
+	}
+	if dtz {
+		for _, m := range maps {
+			for _, values := range m {
+				b = append(b, byte(len(values)))
+				for _, v := range values {
+					b = append(b, byte(v))
+				}
+			}
+		}
+		pad(2)
+	}
+	for _, enc := range encoded {
+		b = append(b, enc.sparse...)
+	}
+	for _, enc := range encoded {
+		b = append(b, enc.counts...)
+	}
+	for _, enc := range encoded {
+		pad(64)
+		b = append(b, enc.blocks...)
+	}
+	return b, nil
+}
+
+// hasValues tells whether any position of a part has a value.
+func hasValues(vs []int) bool {
+	for _, v := range vs {
+		if v >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tbEncodedPart is a part as written: its header, sparse index, value
+// counts of the blocks and blocks.
+type tbEncodedPart struct {
+	header, sparse, counts, blocks []byte
+}
+
+// encodePart compresses the values of a part, -1 where any value does.
+func encodePart(values []int, flags byte) (tbEncodedPart, error) {
+	// A position without a value takes the one before it.
+	seq := make([]int, len(values))
+	last := 0
+	for _, v := range values {
+		if v >= 0 {
+			last = v
+			break
+		}
+	}
+	constant := true
+	for i, v := range values {
+		if v < 0 {
+			v = last
+		}
+		seq[i], last = v, v
+		constant = constant && v == seq[0]
+	}
+	if constant {
+		return tbEncodedPart{header: []byte{flags | tbConstant, byte(seq[0])}}, nil
+	}
+
+	// The symbols are the values, then pairs of the most frequent
+	// neighbors.
+	var syms []tbSymbol
+	leaf := make(map[int]int)
+	for _, v := range seq {
+		if _, ok := leaf[v]; !ok {
+			leaf[v] = -1
+		}
+	}
+	distinct := make([]int, 0, len(leaf))
+	for v := range leaf {
+		distinct = append(distinct, v)
+	}
+	sort.Ints(distinct)
+	for _, v := range distinct {
+		leaf[v] = len(syms)
+		syms = append(syms, tbSymbol{left: v, right: tbLeaf, length: 1})
+	}
+	for i, v := range seq {
+		seq[i] = leaf[v]
+	}
+	for round := 0; round < 64; round++ {
+		n := len(syms)
+		counts := make([]int, n*n)
+		for i := 0; i+1 < len(seq); i++ {
+			if syms[seq[i]].length+syms[seq[i+1]].length <= 256 {
+				counts[seq[i]*n+seq[i+1]]++
+			}
+		}
+		best := 0
+		for i, c := range counts {
+			if c > counts[best] {
+				best = i
+			}
+		}
+		if counts[best] < 8 {
+			break
+		}
+		a, b := best/n, best%n
+		syms = append(syms, tbSymbol{left: a, right: b, length: syms[a].length + syms[b].length})
+		out := seq[:0]
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == a && seq[i+1] == b {
+				out = append(out, n)
+				i++
+			} else {
+				out = append(out, seq[i])
+			}
+		}
+		seq = out
+	}
+
+	// A canonical Huffman code of the symbols that occur, with another
+	// symbol if only one does. The symbols are numbered by descending code
+	// length, the ones without a code last.
+	freq := make([]int, len(syms))
+	for _, s := range seq {
+		freq[s]++
+	}
+	for s := range freq {
+		if freq[s] == 0 && codedSymbols(freq) < 2 {
+			freq[s] = 1
+		}
+	}
+	lengths := huffmanLengths(freq)
+	order := make([]int, len(syms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return lengths[order[i]] > lengths[order[j]] })
+	coded := codedSymbols(freq)
+	maxLen, minLen := lengths[order[0]], lengths[order[coded-1]]
+	if maxLen > 32 {
+		return tbEncodedPart{}, fmt.Errorf("code length %d", maxLen)
+	}
+	number := make([]int, len(syms))
+	for i, s := range order {
+		number[s] = i
+	}
+	firstSym := make([]int, maxLen+1)
+	for l := range firstSym {
+		for _, s := range order[:coded] {
+			if lengths[s] > l {
+				firstSym[l]++
+			}
+		}
+	}
+	lowest := make([]int, maxLen+1)
+	for l := maxLen - 1; l >= minLen; l-- {
+		lowest[l] = (lowest[l+1] + firstSym[l] - firstSym[l+1]) / 2
+	}
+	code := func(s int) int {
+		return lowest[lengths[s]] + number[s] - firstSym[lengths[s]]
+	}
+
+	var enc tbEncodedPart
+	blockBytes := 1 << tbTestBlockBits
+	span := 1 << tbTestSpanBits
+	block := make([]byte, blockBytes)
+	var starts, counts []int
+	bit, n, start := 0, 0, 0
+	flush := func() {
+		enc.blocks = append(enc.blocks, block...)
+		starts = append(starts, start)
+		counts = append(counts, n)
+		block = make([]byte, blockBytes)
+		start += n
+		bit, n = 0, 0
+	}
+	for _, s := range seq {
+		l := lengths[s]
+		if bit+l > 8*blockBytes || n+syms[s].length > 65536-span {
+			flush()
+		}
+		c := code(s)
+		for i := l - 1; i >= 0; i-- {
+			if c>>i&1 != 0 {
+				block[bit/8] |= 0x80 >> (bit % 8)
+			}
+			bit++
+		}
+		n += syms[s].length
+	}
+	flush()
+
+	// An entry of the sparse index points at the middle value of its span.
+	for mid := span / 2; mid-span/2 < len(values); mid += span {
+		b := len(starts) - 1
+		if mid < len(values) {
+			b = sort.Search(len(starts), func(i int) bool { return starts[i] > mid }) - 1
+		}
+		enc.sparse = binary.LittleEndian.AppendUint32(enc.sparse, uint32(b))
+		enc.sparse = binary.LittleEndian.AppendUint16(enc.sparse, uint16(mid-starts[b]))
+	}
+	for _, c := range counts {
+		enc.counts = binary.LittleEndian.AppendUint16(enc.counts, uint16(c-1))
+	}
+
+	h := []byte{flags, tbTestBlockBits, tbTestSpanBits, 0}
+	h = binary.LittleEndian.AppendUint32(h, uint32(len(counts)))
+	h = append(h, byte(maxLen), byte(minLen))
+	for l := minLen; l <= maxLen; l++ {
+		h = binary.LittleEndian.AppendUint16(h, uint16(firstSym[l]))
+	}
+	h = binary.LittleEndian.AppendUint16(h, uint16(len(syms)))
+	for _, s := range order {
+		left, right := syms[s].left, syms[s].right
+		if right != tbLeaf {
+			left, right = number[left], number[right]
+		}
+		h = append(h, byte(left), byte(left>>8&0xF|right<<4), byte(right>>4))
+	}
+	if len(syms)%2 != 0 {
+		h = append(h, 0)
+	}
+	enc.header = h
+	return enc, nil
+}
+
+// codedSymbols returns the number of symbols with a frequency.
+func codedSymbols(freq []int) int {
+	n := 0
+	for _, f := range freq {
+		if f > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// huffmanLengths returns the code lengths of a Huffman code of the symbols
+// with a frequency, 0 for the others.
+func huffmanLengths(freq []int) []int {
+	type node struct {
+		weight int
+		syms   []int
+	}
+	var nodes []node
+	for s, w := range freq {
+		if w > 0 {
+			nodes = append(nodes, node{w, []int{s}})
+		}
+	}
+	lengths := make([]int, len(freq))
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+		a, b := nodes[0], nodes[1]
+		merged := node{a.weight + b.weight, append(append([]int{}, a.syms...), b.syms...)}
+		for _, s := range merged.syms {
+			lengths[s]++
+		}
+		nodes = append(nodes[2:], merged)
+	}
+	return lengths
+}
+
+func TestSyzygyTestdata(t *testing.T) {
+	truth, err := syzygyTestTruth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range syzygyTestTables {
+		for _, dtz := range []bool{false, true} {
+			data, err := writeSyzygy(truth[tc.name], tc.name, dtz, tc.dtzBlack)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(syzygyDir, tc.name+".rtbw")
+			if dtz {
+				path = filepath.Join(syzygyDir, tc.name+".rtbz")
+			}
+			if *updateSyzygy {
+				if err := os.MkdirAll(syzygyDir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			if old, err := os.ReadFile(path); err != nil || !bytes.Equal(old, data) {
+				t.Errorf("%s is not up to date, run go test -run TestSyzygyTestdata -update", path)
+			}
+		}
+	}
+}
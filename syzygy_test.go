@@ -0,0 +1,114 @@
+package chess
+
+import (
+	"os"
+	"testing"
+)
+
+// syzygyDir holds the Syzygy tables of the tests, see syzygyTestTables.
+// The tests are skipped without them.
+const syzygyDir = "testdata/syzygy"
+
+func openTestTablebases(t *testing.T) *Syzygy {
+	t.Helper()
+	if _, err := os.Stat(syzygyDir + "/KRvK.rtbw"); err != nil {
+		t.Skip("no Syzygy tables in " + syzygyDir)
+	}
+	tb, err := OpenSyzygy(syzygyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func TestSyzygyProbe(t *testing.T) {
+	tb := openTestTablebases(t)
+	tests := []struct {
+		fen string
+		wdl WDL
+		dtz int
+	}{
+		{"6k1/8/6K1/8/8/8/8/R7 w - - 0 1", WDLWin, 1},   // Ra8#
+		{"8/8/8/8/8/8/8/K1k4R b - - 0 1", WDLLoss, 0},   // black in check
+		{"8/8/8/8/8/8/8/K5kQ b - - 0 1", WDLDraw, 0},    // Kxh1
+		{"8/8/8/8/8/8/8/k5Kq w - - 0 1", WDLDraw, 0},    // colors swapped
+		{"8/8/8/3k4/8/8/8/K7 w - - 0 1", WDLDraw, 0},    // bare kings
+		{"1k6/1P6/1K6/8/8/8/8/8 b - - 0 1", WDLDraw, 0}, // stalemate
+		{"7r/8/8/8/8/8/8/k1K5 b - - 0 1", WDLWin, 0},    // rook of Black
+		{"7r/8/8/8/8/8/8/k1K5 w - - 0 1", WDLLoss, 0},
+		{"4k3/8/8/8/8/8/8/4K2R w - - 0 1", WDLWin, 0}, // no castling rights
+	}
+	for _, tc := range tests {
+		game, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wdl, err := tb.ProbeWDL(game)
+		if err != nil {
+			t.Errorf("%s: %v", tc.fen, err)
+			continue
+		}
+		if wdl != tc.wdl {
+			t.Errorf("%s: got WDL %d, want %d", tc.fen, wdl, tc.wdl)
+		}
+		if tc.dtz == 0 {
+			continue
+		}
+		if dtz, err := tb.ProbeDTZ(game); err != nil || dtz != tc.dtz {
+			t.Errorf("%s: got DTZ %d (%v), want %d", tc.fen, dtz, err, tc.dtz)
+		}
+	}
+}
+
+func TestSyzygySearch(t *testing.T) {
+	openTestTablebases(t)
+	if err := SetSyzygyPath(syzygyDir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetSyzygyPath("")
+
+	game, err := ParseFEN("6k1/8/6K1/8/8/8/8/R7 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := SearchDepth(game, 1)
+	if got := r.Move.UCI(); got != "a1a8" {
+		t.Errorf("got %s, want a1a8", got)
+	}
+}
+
+// TestSyzygyTables compares the probes of the test tables with the values
+// they were written from, for the positions of every seventh key and for
+// the same positions with the colors swapped.
+func TestSyzygyTables(t *testing.T) {
+	tb := openTestTablebases(t)
+	truth, err := syzygyTestTruth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"KQvK", "KRvK", "KPvK"} {
+		tt := truth[name]
+		errors := 0
+		for k := 0; k < len(tt.legal) && errors < 10; k += 7 {
+			if !tt.legal[k] {
+				continue
+			}
+			pos := tt.position(k)
+			swapped := &BitPosition{turn: opposite(pos.turn), ep: noSquare}
+			for sq := range swapped.squares {
+				swapped.squares[sq] = noPiece
+			}
+			for _, pc := range tt.t.pieces {
+				swapped.put(pos.pieces[pc.color][pc.pt].lsb()^56, opposite(pc.color), pc.pt)
+			}
+			for _, p := range []*BitPosition{pos, swapped} {
+				wdl, ok := tb.probeWDL(p)
+				dtz, ok2 := tb.probeDTZ(p)
+				if !ok || !ok2 || wdl != tt.wdl[k] || dtz != tt.dtz[k] {
+					t.Errorf("%s: got WDL %d DTZ %d (%v %v), want %d %d", p.Board().FEN(), wdl, dtz, ok, ok2, tt.wdl[k], tt.dtz[k])
+					errors++
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package chess
+
+import "sync/atomic"
+
+// DefaultHashSize is the size of the transposition table in megabytes
+// unless changed with SetHashSize.
+const DefaultHashSize = 16
+
+// Bound types of a transposition table entry.
+const (
+	boundExact = iota + 1 // the score is exact
+	boundLower            // the score is a lower bound (fail high)
+	boundUpper            // the score is an upper bound (fail low)
+)
+
+// noSquare marks a missing square, e.g. of the en passant target.
+const noSquare = -1
+
+type ttEntry struct {
+	key   uint64
+	score int32
+	depth int16
+	bound uint8
+	move  bitMove // best move, zero if none
+}
+
+// TranspositionTable caches search results by position hash. It has a
+// fixed number of slots; a new entry replaces an older one of the same
+// slot unless that one was searched deeper for the same position.
+//
+// The table is shared by the threads of a parallel search without locks:
+// a slot holds the entry data packed into one word and the key xor the
+// data in another, so a slot torn by concurrent writes fails the key check.
+type TranspositionTable struct {
+	slots []ttSlot
+	mask  uint64
+}
+
+type ttSlot struct {
+	check uint64 // key ^ data
+	data  uint64
+}
+
+// pack returns the entry without its key as one word: the score in bits
+// 0-31, the depth in bits 32-39, the bound in bits 40-41 and the move in
+// bits 48-63.
+func (e ttEntry) pack() uint64 {
+	return uint64(uint32(e.score)) | uint64(uint8(e.depth))<<32 | uint64(e.bound&3)<<40 | uint64(e.move)<<48
+}
+
+func unpack(key, data uint64) ttEntry {
+	return ttEntry{
+		key:   key,
+		score: int32(uint32(data)),
+		depth: int16(uint8(data >> 32)),
+		bound: uint8(data>>40) & 3,
+		move:  bitMove(data >> 48),
+	}
+}
+
+var tt = NewTranspositionTable(DefaultHashSize)
+
+// SetHashSize replaces the transposition table used by the search with an
+// empty one of the given size in megabytes, once running searches have
+// ended.
+func SetHashSize(sizeMB int) {
+	table := NewTranspositionTable(sizeMB)
+	settings.Lock()
+	defer settings.Unlock()
+	tt = table
+}
+
+// ClearHash empties the transposition table used by the search, e.g. when
+// a new game starts. It waits for running searches to end.
+func ClearHash() {
+	settings.Lock()
+	defer settings.Unlock()
+	tt.Clear()
+}
+
+// NewTranspositionTable returns an empty table of at most sizeMB megabytes.
+func NewTranspositionTable(sizeMB int) *TranspositionTable {
+	const slotSize = 16
+	n := uint64(1)
+	for n*2*slotSize <= uint64(sizeMB)<<20 {
+		n *= 2
+	}
+	return &TranspositionTable{slots: make([]ttSlot, n), mask: n - 1}
+}
+
+// Clear removes all entries from the table.
+func (t *TranspositionTable) Clear() {
+	for i := range t.slots {
+		atomic.StoreUint64(&t.slots[i].check, 0)
+		atomic.StoreUint64(&t.slots[i].data, 0)
+	}
+}
+
+func (t *TranspositionTable) probe(key uint64) (ttEntry, bool) {
+	slot := &t.slots[key&t.mask]
+	data := atomic.LoadUint64(&slot.data)
+	if atomic.LoadUint64(&slot.check)^data != key {
+		return ttEntry{}, false
+	}
+	e := unpack(key, data)
+	return e, e.bound != 0
+}
+
+func (t *TranspositionTable) store(key uint64, depth, score, bound int, best bitMove) {
+	if old, ok := t.probe(key); ok && int(old.depth) > depth {
+		return
+	}
+	data := ttEntry{score: int32(score), depth: int16(depth), bound: uint8(bound), move: best}.pack()
+	slot := &t.slots[key&t.mask]
+	atomic.StoreUint64(&slot.data, data)
+	atomic.StoreUint64(&slot.check, key^data)
+}
@@ -0,0 +1,177 @@
+package chess
+
+// Zobrist keys: one random number per piece on each square, for the side
+// to move, each castling right and each en passant file. The hash of a
+// position is the xor of the keys of all its features.
+var zobrist struct {
+	pieces   [2][6][64]uint64
+	black    uint64
+	castling [4]uint64
+	epFile   [8]uint64
+
+	castlingMasks [16]uint64 // xor of the castling keys of each mask
+}
+
+// Castling rights as bits of a castling mask, in FEN order.
+const (
+	castleWhiteKingside = 1 << iota
+	castleWhiteQueenside
+	castleBlackKingside
+	castleBlackQueenside
+)
+
+func init() {
+	// splitmix64 with a fixed seed, so hashes are stable between runs.
+	seed := uint64(0x2545F4914F6CDD1D)
+	next := func() uint64 {
+		seed += 0x9E3779B97F4A7C15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		return z ^ (z >> 31)
+	}
+	for c := range zobrist.pieces {
+		for pt := range zobrist.pieces[c] {
+			for sq := range zobrist.pieces[c][pt] {
+				zobrist.pieces[c][pt][sq] = next()
+			}
+		}
+	}
+	zobrist.black = next()
+	for i := range zobrist.castling {
+		zobrist.castling[i] = next()
+	}
+	for i := range zobrist.epFile {
+		zobrist.epFile[i] = next()
+	}
+	for mask := range zobrist.castlingMasks {
+		for i, key := range zobrist.castling {
+			if mask&(1<<i) != 0 {
+				zobrist.castlingMasks[mask] ^= key
+			}
+		}
+	}
+}
+
+// Hash returns the Zobrist hash of the current position, covering piece
+// placement, side to move, castling rights and en passant file.
+func (g *Game) Hash() uint64 {
+	return g.hash
+}
+
+// rehash computes the hash of the current position from scratch.
+func (g *Game) rehash() {
+	g.hash = hashPosition(g.board, g.turn, g.enPassant)
+}
+
+func hashPosition(board *Board, turn Color, ep *Position) uint64 {
+	var h uint64
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			if p := board[r][c]; p != nil {
+				h ^= pieceKey(p, Position{Row: r, Col: c})
+			}
+		}
+	}
+	if turn == Black {
+		h ^= zobrist.black
+	}
+	return h ^ castlingKey(castlingMask(board)) ^ epKey(board, ep, turn)
+}
+
+func pieceKey(p *Piece, pos Position) uint64 {
+	return zobrist.pieces[p.color][p.pieceType][pos.Row*8+pos.Col]
+}
+
+func castlingKey(mask int) uint64 {
+	return zobrist.castlingMasks[mask]
+}
+
+// epKey returns the key of the en passant file. It is only hashed if a pawn
+// of the side to move can legally capture en passant, so positions that
+// only differ by an unusable en passant square hash equally, as FIDE
+// position identity requires.
+func epKey(board *Board, ep *Position, turn Color) uint64 {
+	if ep == nil {
+		return 0
+	}
+	row := ep.Row + 1
+	if turn == Black {
+		row = ep.Row - 1
+	}
+	for _, c := range []int{ep.Col - 1, ep.Col + 1} {
+		if c < 0 || c > 7 {
+			continue
+		}
+		p := board[row][c]
+		if p != nil && p.pieceType == Pawn && p.color == turn && isLegalEnPassant(board, Position{Row: row, Col: c}, *ep) {
+			return zobrist.epFile[ep.Col]
+		}
+	}
+	return 0
+}
+
+// isLegalEnPassant tells whether the en passant capture of the pawn on from
+// to the square ep leaves the own king safe. The capture is tried on a copy
+// of the board.
+func isLegalEnPassant(board *Board, from, ep Position) bool {
+	after := *board
+	pawn := after[from.Row][from.Col]
+	after[ep.Row][ep.Col], after[from.Row][from.Col], after[from.Row][ep.Col] = pawn, nil, nil
+	return !isCheck(&after, pawn.color)
+}
+
+// castlingMask returns the castling rights of the position, judging by
+// whether kings and rooks are still unmoved on their initial squares.
+func castlingMask(board *Board) int {
+	unmoved := func(row, col int, pt PieceType, color Color) bool {
+		p := board[row][col]
+		return p != nil && p.pieceType == pt && p.color == color && !p.hasMoved
+	}
+	mask := 0
+	if unmoved(7, 4, King, White) {
+		if unmoved(7, 7, Rook, White) {
+			mask |= castleWhiteKingside
+		}
+		if unmoved(7, 0, Rook, White) {
+			mask |= castleWhiteQueenside
+		}
+	}
+	if unmoved(0, 4, King, Black) {
+		if unmoved(0, 7, Rook, Black) {
+			mask |= castleBlackKingside
+		}
+		if unmoved(0, 0, Rook, Black) {
+			mask |= castleBlackQueenside
+		}
+	}
+	return mask
+}
+
+// moveHashDelta returns the value to xor into the hash of a position for
+// the piece movements of a move that is about to be played on the board.
+// Castling rights and en passant keys are not included.
+func moveHashDelta(board *Board, m Move) uint64 {
+	from, to := m.from, m.to
+	piece := board[from.Row][from.Col]
+	h := pieceKey(piece, from) ^ zobrist.black
+
+	if captured := board[to.Row][to.Col]; captured != nil {
+		h ^= pieceKey(captured, to)
+	} else if piece.pieceType == Pawn && from.Col != to.Col {
+		ep := Position{Row: from.Row, Col: to.Col}
+		h ^= pieceKey(board[ep.Row][ep.Col], ep)
+	}
+
+	if m.isPromotion {
+		h ^= zobrist.pieces[piece.color][m.promotion][to.Row*8+to.Col]
+	} else {
+		h ^= pieceKey(piece, to)
+	}
+
+	if rookFrom, rookTo, ok := castlingRookMove(piece, m); ok {
+		rook := board[rookFrom.Row][rookFrom.Col]
+		h ^= pieceKey(rook, rookFrom) ^ pieceKey(rook, rookTo)
+	}
+	return h
+}